@@ -0,0 +1,66 @@
+package commands
+
+import (
+	"esdt/esdt"
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+)
+
+var ApplyCommand = cli.Command{
+	Name:      "apply",
+	Usage:     "Bring the index templates, component templates, pipelines, ILM policies and aliases declared in the resources directory in line with the cluster, making only the changes needed.",
+	ArgsUsage: "[Flags]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: applyAction,
+	Flags:  applyFlags,
+}
+
+var applyFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "resources, r",
+		Usage: "The directory declaring the resources.\tDefault: " + esdt.DefaultResourcesDir,
+	},
+	cli.BoolFlag{
+		Name:  "prune",
+		Usage: "Delete the resources managed by esdt which are no longer declared.\tOptional",
+	},
+	cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the changes without making them.\tOptional",
+	},
+}
+
+func applyAction(c *cli.Context) error {
+	e := newEsdt(c)
+
+	var changes []*esdt.ResourceChange
+	var err error
+	if c.Bool("dry-run") {
+		changes, err = e.PlanResources(c.Bool("prune"))
+	} else {
+		changes, err = e.Apply(c.Bool("prune"))
+	}
+
+	for _, v := range changes {
+		switch v.Action {
+		case esdt.ResourceCreate:
+			color.Green("%s", v.String())
+		case esdt.ResourceUpdate:
+			color.Yellow("%s", v.String())
+		default:
+			color.Red("%s", v.String())
+		}
+	}
+
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to apply resources: %s", err.Error()), 1)
+	}
+
+	if len(changes) == 0 {
+		color.Green("All resources are up to date")
+	}
+
+	return nil
+}
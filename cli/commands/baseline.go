@@ -0,0 +1,41 @@
+package commands
+
+import (
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+)
+
+var BaselineCommand = cli.Command{
+	Name:      "baseline",
+	Usage:     "Mark all data templates up to and including the given data template ID as applied without running them. Used to adopt esdt on an existing cluster.",
+	ArgsUsage: "[Flags]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: baselineAction,
+	Flags:  baselineFlags,
+}
+
+var baselineFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "to, t",
+		Usage: "The last data template ID to mark as applied.\tRequired",
+	},
+}
+
+func baselineAction(c *cli.Context) error {
+	to := c.String("to")
+
+	if to == "" {
+		return cli.NewExitError(color.RedString("A data template ID is required"), 1)
+	}
+
+	e := newEsdt(c)
+
+	err := e.Baseline(to)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to baseline: %s", err.Error()), 1)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+	"sort"
+)
+
+var DiffMappingCommand = cli.Command{
+	Name:      "diff-mapping",
+	Usage:     "Compare the live mapping of an index with a new mapping, given as a data template or a mapping file. Exits non-zero if a change requires a reindex.",
+	ArgsUsage: "<index> <file>",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: diffMappingAction,
+}
+
+func diffMappingAction(c *cli.Context) error {
+	index := c.Args().Get(0)
+	file := c.Args().Get(1)
+
+	if index == "" || file == "" {
+		return cli.NewExitError(color.RedString("An index and a mapping file are required"), 1)
+	}
+
+	e := newEsdt(c)
+
+	diffs, err := e.DiffMapping(index, file)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to diff mapping: %s", err.Error()), 1)
+	}
+
+	indices := make([]string, 0, len(diffs))
+	for k := range diffs {
+		indices = append(indices, k)
+	}
+	sort.Strings(indices)
+
+	breaking := 0
+	for _, index := range indices {
+		prefix := ""
+		if len(indices) > 1 {
+			prefix = index + " "
+		}
+		if len(diffs[index]) == 0 {
+			color.Green("%sThe mapping is unchanged", prefix)
+		}
+		for _, v := range diffs[index] {
+			if v.Breaking {
+				breaking++
+				color.Red("%s%s", prefix, v.String())
+			} else {
+				color.Green("%s%s", prefix, v.String())
+			}
+		}
+	}
+
+	if breaking > 0 {
+		return cli.NewExitError(color.RedString("Found %d breaking changes, the index must be reindexed", breaking), 1)
+	}
+
+	return nil
+}
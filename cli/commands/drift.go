@@ -0,0 +1,60 @@
+package commands
+
+import (
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+)
+
+var DriftCommand = cli.Command{
+	Name:      "drift",
+	Usage:     "Compare the mappings, settings, aliases, templates and pipelines managed by esdt between two environments in the config file. Exits non-zero if they have drifted.",
+	ArgsUsage: "[Flags]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: driftAction,
+	Flags:  driftFlags,
+}
+
+var driftFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "against, a",
+		Usage: "The environment to compare the env against.\tRequired",
+	},
+}
+
+func driftAction(c *cli.Context) error {
+	against := c.String("against")
+
+	if against == "" {
+		return cli.NewExitError(color.RedString("An environment to compare against is required"), 1)
+	}
+
+	e := newEsdt(c)
+	env := e.GetConfig().Env
+
+	items, err := e.Drift(against)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to detect drift: %s", err.Error()), 1)
+	}
+
+	if len(items) == 0 {
+		color.Green("No drift between %s and %s", env, against)
+		return nil
+	}
+
+	resource := ""
+	for _, v := range items {
+		if v.Resource != resource {
+			resource = v.Resource
+			color.Yellow("%s", resource)
+		}
+		field := v.Field
+		if field == "" {
+			field = "(resource)"
+		}
+		color.Red("  %s\n    %s: %s\n    %s: %s", field, env, v.Value, against, v.AgainstValue)
+	}
+
+	return cli.NewExitError(color.RedString("Found %d differences between %s and %s", len(items), env, against), 1)
+}
@@ -11,6 +11,7 @@ var GenerateCommand = cli.Command{
 	Subcommands: []cli.Command{
 		GenerateOperationCommand,
 		GenerateDirCommand,
+		GenerateFromClusterCommand,
 		HelpCommand,
 	},
 }
@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"esdt/esdt"
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+var GenerateFromClusterCommand = cli.Command{
+	Name:      "from-cluster",
+	Usage:     "Generate the data templates which recreate the indices, templates and pipelines of an existing cluster",
+	ArgsUsage: "[Flags]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: generateFromClusterAction,
+	Flags:  generateFromClusterFlags,
+}
+
+var generateFromClusterFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "indices, i",
+		Usage: "The indices to generate data templates for, as a comma separated list or pattern\tDefault: *",
+		Value: "*",
+	},
+	cli.StringFlag{
+		Name:  "format, f",
+		Usage: "The format of the data template files. Can be json or yaml\tDefault: json",
+		Value: "json",
+	},
+}
+
+func generateFromClusterAction(c *cli.Context) error {
+	e := newEsdt(c)
+
+	format, ok := operationFormats[strings.ToLower(c.String("format"))]
+	if !ok {
+		return cli.NewExitError(color.RedString("Format must be one of json, yaml"), 1)
+	}
+
+	operations, err := e.Export(c.String("indices"))
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to read the cluster: %s", err.Error()), 1)
+	}
+
+	dir := e.GetConfig().Directories()[0]
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to generate data templates: %s", err), 1)
+	}
+
+	// Each data template is a second apart so that they run in the order they were read
+	start := time.Now()
+	for i, v := range operations {
+		fileName := start.Add(time.Duration(i)*time.Second).Format(timeFormatString) + "_" + v.Id + format.Extension
+
+		content, err := esdt.EncodeOperation(fileName, v)
+		if err != nil {
+			return cli.NewExitError(color.RedString("Failed to generate %s: %s", fileName, err), 1)
+		}
+
+		err = ioutil.WriteFile(path.Join(dir, fileName), content, 0644)
+		if err != nil {
+			return cli.NewExitError(color.RedString("Failed to generate %s: %s", fileName, err), 1)
+		}
+		color.Green("Generated %s", fileName)
+	}
+
+	if len(operations) == 0 {
+		color.Yellow("Found nothing to generate")
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package commands
 
 import (
 	"esdt/cli/io"
+	"esdt/esdt"
 	"github.com/fatih/color"
 	"github.com/homee-engineering/go-commons/slice"
 	"github.com/urfave/cli"
@@ -35,6 +36,26 @@ var generateOperationFlags = []cli.Flag{
 		Name:  "uri, u",
 		Usage: "The URI to be used against Elasticsearch e.g. _bulk. Will be concatenated with the conn arg\tRequired",
 	},
+	cli.BoolFlag{
+		Name:  "auto-rollback, a",
+		Usage: "Derive the rollback from the operation when it is rolled back instead of listing it in the file\tOptional",
+	},
+	cli.StringFlag{
+		Name:  "format, f",
+		Usage: "The format of the operation file. Can be json or yaml\tDefault: json",
+		Value: "json",
+	},
+}
+
+type operationFormat struct {
+	Template  string
+	Extension string
+}
+
+var operationFormats = map[string]operationFormat{
+	"json": {"template.json", ".json"},
+	"yaml": {"template.yml", ".yml"},
+	"yml":  {"template.yml", ".yml"},
 }
 
 var validElasticSearchHttpMethods = []string{
@@ -49,6 +70,8 @@ type templateModel struct {
 	Method         string
 	Uri            string
 	OppositeMethod string
+	RollbackUri    string
+	AutoRollback   bool
 }
 
 func generateOperationAction(c *cli.Context) error {
@@ -65,28 +88,54 @@ func generateOperationAction(c *cli.Context) error {
 		return cli.NewExitError(color.RedString("A data template name is required"), 1)
 	}
 
+	format, ok := operationFormats[strings.ToLower(c.String("format"))]
+	if !ok {
+		return cli.NewExitError(color.RedString("Format must be one of json, yaml"), 1)
+	}
+
+	// A name such as users/create_users generates the data template in a subdirectory
+	dir := path.Join(e.GetConfig().Directories()[0], path.Dir(name))
+	name = path.Base(name)
+
 	timestamp := time.Now().Format(timeFormatString)
-	fileName := timestamp + "_" + name + ".json"
+	fileName := timestamp + "_" + name + format.Extension
 	oppositeMethod := "delete"
+	var rollbackUri string
 	switch strings.ToLower(method) {
 	case "delete":
 		oppositeMethod = "post"
 	case "post", "put":
 		oppositeMethod = "delete"
 	}
-	fp, err := io.ApplyTemplate("template.json", templateModel{
+	rollback, ok := esdt.DeriveRollback(&esdt.Operation{Method: method, Uri: uri})
+	if ok {
+		oppositeMethod = rollback.Method
+		rollbackUri = rollback.Uri
+	} else if !c.Bool("auto-rollback") {
+		// Defaults to the same resource, which is usually what the rollback targets
+		rollbackUri = uri
+		color.Yellow("Could not derive a rollback for %s %s, check the rollback in %s", strings.ToUpper(method), uri, fileName)
+	}
+	fp, err := io.ApplyTemplate(format.Template, templateModel{
 		Method:         strings.ToUpper(method),
 		Uri:            uri,
 		OppositeMethod: strings.ToUpper(oppositeMethod),
+		RollbackUri:    rollbackUri,
+		AutoRollback:   c.Bool("auto-rollback"),
 	})
 
 	if err != nil {
-		return cli.NewExitError(color.RedString("Failed to generate json: %s", err), 1)
+		return cli.NewExitError(color.RedString("Failed to generate %s: %s", fileName, err), 1)
+	}
+
+	err = os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to generate %s: %s", fileName, err), 1)
 	}
 
-	err = os.Rename(fp, path.Join(e.GetConfig().TargetDir, fileName))
+	err = os.Rename(fp, path.Join(dir, fileName))
 	if err != nil {
-		return cli.NewExitError(color.RedString("Failed to generate json: %s", err), 1)
+		return cli.NewExitError(color.RedString("Failed to generate %s: %s", fileName, err), 1)
 	}
 
 	return nil
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"esdt/esdt"
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+	"strings"
+)
+
+var MarkCommand = cli.Command{
+	Name:      "mark",
+	Usage:     "Change the recorded state of a data template without running it or its rollback",
+	ArgsUsage: "[Command]",
+	Subcommands: []cli.Command{
+		MarkAppliedCommand,
+		MarkPendingCommand,
+		HelpCommand,
+	},
+}
+
+var MarkAppliedCommand = cli.Command{
+	Name:      "applied",
+	Usage:     "Record a data template as applied without running it",
+	ArgsUsage: "[Flags] [Data Template ID]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: markAppliedAction,
+	Flags:  markFlags,
+}
+
+var MarkPendingCommand = cli.Command{
+	Name:      "pending",
+	Usage:     "Remove the record of a data template without running its rollback so it is run again",
+	ArgsUsage: "[Flags] [Data Template ID]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: markPendingAction,
+	Flags:  markFlags,
+}
+
+var markFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "force, f",
+		Usage: "Required to change records in a protected environment.\tOptional",
+	},
+}
+
+func markAppliedAction(c *cli.Context) error {
+	id := c.Args().First()
+	if id == "" {
+		return cli.NewExitError(color.RedString("A data template ID is required"), 1)
+	}
+
+	e := newEsdt(c)
+
+	err := e.MarkApplied(id, c.Bool("force"))
+	if err != nil {
+		return handleMarkError(err, id)
+	}
+
+	color.Green("%s marked as applied", id)
+	return nil
+}
+
+func markPendingAction(c *cli.Context) error {
+	id := c.Args().First()
+	if id == "" {
+		return cli.NewExitError(color.RedString("A data template ID is required"), 1)
+	}
+
+	e := newEsdt(c)
+
+	err := e.MarkPending(id, c.Bool("force"))
+	if err != nil {
+		return handleMarkError(err, id)
+	}
+
+	color.Green("%s marked as pending", id)
+	return nil
+}
+
+func handleMarkError(err error, id string) error {
+	if strings.Contains(err.Error(), esdt.ProtectedEnvErrorMsg) {
+		return cli.NewExitError(color.RedString("Refusing to mark %s in a protected environment. Use --force to override", id), 1)
+	}
+	return cli.NewExitError(color.RedString("Failed to mark %s: %s", id, err.Error()), 1)
+}
@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"esdt/esdt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"path/filepath"
+	"strings"
+)
+
+var RedoCommand = cli.Command{
+	Name:      "redo",
+	Usage:     "Rollback a single data template and run it again. The data template ID is defined as the filename of the data template minus the extension.",
+	ArgsUsage: "[Data Template ID]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: redoAction,
+}
+
+func redoAction(c *cli.Context) error {
+	id := c.Args().First()
+
+	if id == "" {
+		return cli.NewExitError(color.RedString("A data template ID is required"), 1)
+	}
+
+	if esdt.OperationRegEx.MatchString(id) {
+		id = strings.TrimSuffix(id, filepath.Ext(id))
+	}
+
+	e := newEsdt(c)
+
+	operation, err := e.Load(id)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to load %s: %s", id, err.Error()), 1)
+	}
+
+	err = e.Redo(operation)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), esdt.RedoRollbackFailedMsg) {
+			handleRollbackError(errors.Cause(err), id)
+			return cli.NewExitError(color.RedString("%s was not run again", id), 1)
+		}
+		color.Green("Successfully rolled back %s", id)
+		return cli.NewExitError(color.RedString("%s failed to run: %s", id, errors.Cause(err).Error()), 1)
+	}
+
+	color.Green("Successfully rolled back %s", id)
+	color.Green("%s ran successfully", id)
+
+	return nil
+}
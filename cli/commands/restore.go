@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"esdt/esdt"
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+	"path/filepath"
+	"strings"
+)
+
+var RestoreCommand = cli.Command{
+	Name:      "restore",
+	Usage:     "Restore the indices of a data template from the snapshot taken before it ran. The data template ID is defined as the filename of the data template minus the extension.",
+	ArgsUsage: "[Data Template ID]",
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: restoreAction,
+}
+
+func restoreAction(c *cli.Context) error {
+	id := c.Args().First()
+
+	if id == "" {
+		return cli.NewExitError(color.RedString("A data template ID is required"), 1)
+	}
+
+	if esdt.OperationRegEx.MatchString(id) {
+		id = strings.TrimSuffix(id, filepath.Ext(id))
+	}
+
+	e := newEsdt(c)
+
+	err := e.Restore(id)
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to restore %s: %s", id, err.Error()), 1)
+	}
+
+	color.Green("Successfully restored %s", id)
+
+	return nil
+}
@@ -1,12 +1,10 @@
 package commands
 
 import (
-	"errors"
 	"esdt/esdt"
-	"fmt"
 	"github.com/fatih/color"
 	"github.com/urfave/cli"
-	"io/ioutil"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -38,28 +36,30 @@ func rollbackAction(c *cli.Context) error {
 		return cli.NewExitError(color.RedString("A data template ID is required"), 1)
 	}
 
-	if esdt.JsonRegEx.MatchString(rollbackId) {
+	if esdt.OperationRegEx.MatchString(rollbackId) {
 		rollbackId = strings.TrimSuffix(rollbackId, filepath.Ext(rollbackId))
 	}
-	if esdt.JsonRegEx.MatchString(from) {
+	if esdt.OperationRegEx.MatchString(from) {
 		from = strings.TrimSuffix(from, filepath.Ext(from))
 	}
 
 	e := newEsdt(c)
 
 	if from == "" {
-		err := e.RollbackFile(rollbackId + ".json")
+		err := e.RollbackFile(rollbackId)
 
 		handleRollbackError(err, rollbackId)
 	} else {
-		fi, err := ioutil.ReadDir(e.GetConfig().TargetDir)
+		operations, err := e.LoadAll()
 		if err != nil {
-			return errors.New(fmt.Sprintf("Could not find directory %s", e.GetConfig().TargetDir))
+			return cli.NewExitError(color.RedString("Failed to load data templates: %s", err.Error()), 1)
 		}
-		for _, f := range fi {
-			if esdt.JsonRegEx.MatchString(f.Name()) && f.Name() >= from && f.Name() <= rollbackId+".json" {
-				err := e.RollbackFile(f.Name())
-				handleRollbackError(err, strings.TrimSuffix(f.Name(), filepath.Ext(f.Name())))
+		// Data templates are ordered by filename, whichever directory they are in
+		for _, v := range operations {
+			name := path.Base(v.Id)
+			if name >= path.Base(from) && name <= path.Base(rollbackId) {
+				err := e.Rollback(v)
+				handleRollbackError(err, v.Id)
 			}
 		}
 	}
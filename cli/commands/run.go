@@ -14,6 +14,26 @@ var RunCommand = cli.Command{
 		HelpCommand,
 	},
 	Action: runAction,
+	Flags:  runFlags,
+}
+
+var runFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "snapshot, s",
+		Usage: "The snapshot repository to snapshot the targeted indices into before each data template runs.\tOptional",
+	},
+	cli.BoolFlag{
+		Name:  "skip-invalid",
+		Usage: "Run the valid data templates even if other files in the target directory could not be loaded.\tOptional",
+	},
+	cli.DurationFlag{
+		Name:  "wait, w",
+		Usage: "How long to wait for Elasticsearch to become reachable and healthy before running e.g. 120s.\tOptional",
+	},
+	cli.StringFlag{
+		Name:  "wait-status",
+		Usage: "The cluster health status to wait for, either red, yellow or green.\tDefault: yellow",
+	},
 }
 
 func runAction(c *cli.Context) error {
@@ -21,7 +41,7 @@ func runAction(c *cli.Context) error {
 
 	err := e.RunAll()
 	if err != nil {
-		return cli.NewExitError(color.RedString("Failed to create operations index: %s", err.Error()), 1)
+		return cli.NewExitError(color.RedString("Failed to run data templates: %s", err.Error()), 1)
 	}
 
 	return nil
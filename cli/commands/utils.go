@@ -2,7 +2,9 @@ package commands
 
 import (
 	"esdt/esdt"
+	"github.com/fatih/color"
 	"github.com/urfave/cli"
+	"strings"
 )
 
 func newEsdt(ctx *cli.Context) esdt.Esdt {
@@ -12,15 +14,77 @@ func newEsdt(ctx *cli.Context) esdt.Esdt {
 	env := ctx.GlobalString("env")
 	pw := ctx.GlobalString("password")
 	user := ctx.GlobalString("username")
+	pwFile := ctx.GlobalString("password-file")
+	apiKey := ctx.GlobalString("api-key")
+	token := ctx.GlobalString("bearer-token")
+	authMode := ctx.GlobalString("auth-mode")
+	awsRegion := ctx.GlobalString("aws-region")
+	awsService := ctx.GlobalString("aws-service")
+	awsProfile := ctx.GlobalString("aws-profile")
+	snapshotRepo := ctx.String("snapshot")
+	resourcesDir := ctx.String("resources")
+	waitForCluster := ctx.Duration("wait")
+	waitForStatus := ctx.String("wait-status")
+	skipInvalid := ctx.Bool("skip-invalid")
+	exclude := ctx.GlobalStringSlice("exclude")
+	maxAttempts := ctx.GlobalInt("max-attempts")
+	timeout := ctx.GlobalDuration("timeout")
+	caCert := ctx.GlobalString("ca-cert")
+	clientCert := ctx.GlobalString("client-cert")
+	clientKey := ctx.GlobalString("client-key")
+	serverName := ctx.GlobalString("server-name")
+	insecure := ctx.GlobalBool("insecure")
+	proxy := ctx.GlobalString("proxy")
+	headers := parseHeaders(ctx.GlobalStringSlice("header"))
 
 	in := &esdt.Config{
-		ConfigFile: configFile,
-		TargetDir:  targetDir,
-		Conn:       conn,
-		Env:        env,
-		Password:   pw,
-		Username:   user,
+		ConfigFile:     configFile,
+		TargetDir:      targetDir,
+		Conn:           conn,
+		Env:            env,
+		Password:       pw,
+		Username:       user,
+		PasswordFile:   pwFile,
+		ApiKey:         apiKey,
+		BearerToken:    token,
+		AuthMode:       authMode,
+		AwsRegion:      awsRegion,
+		AwsService:     awsService,
+		AwsProfile:     awsProfile,
+		SnapshotRepo:   snapshotRepo,
+		ResourcesDir:   resourcesDir,
+		WaitForCluster: waitForCluster,
+		WaitForStatus:  waitForStatus,
+		SkipInvalid:    skipInvalid,
+		Exclude:        exclude,
+		MaxAttempts:    maxAttempts,
+		Timeout:        timeout,
+		CACert:         caCert,
+		ClientCert:     clientCert,
+		ClientKey:      clientKey,
+		ServerName:     serverName,
+		Insecure:       insecure,
+		Proxy:          proxy,
+		Headers:        headers,
 	}
 
 	return esdt.New(in)
 }
+
+// Parses headers given as "Name: value"
+func parseHeaders(flags []string) map[string]string {
+	if len(flags) == 0 {
+		return nil
+	}
+
+	headers := make(map[string]string)
+	for _, v := range flags {
+		kv := strings.SplitN(v, ":", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			color.Yellow("Ignoring header %s, expected Name: value", v)
+			continue
+		}
+		headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return headers
+}
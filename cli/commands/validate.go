@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"github.com/fatih/color"
+	"github.com/urfave/cli"
+)
+
+var ValidateCommand = cli.Command{
+	Name:      "validate",
+	Usage:     "Check every data template in the target directory without running anything. Exits non-zero if a problem is found.",
+	ArgsUsage: "[Flags]",
+	Aliases:   []string{"lint"},
+	Subcommands: []cli.Command{
+		HelpCommand,
+	},
+	Action: validateAction,
+	Flags:  validateFlags,
+}
+
+var validateFlags = []cli.Flag{
+	cli.BoolFlag{
+		Name:  "allow-warnings",
+		Usage: "Exit zero when only warnings are found, e.g. missing rollbacks.\tOptional",
+	},
+	cli.BoolFlag{
+		Name:  "mappings",
+		Usage: "Also compare the mapping updates which have not run with the live mappings, reporting breaking changes.\tOptional",
+	},
+}
+
+func validateAction(c *cli.Context) error {
+	e := newEsdt(c)
+
+	issues, err := e.Validate()
+	if err != nil {
+		return cli.NewExitError(color.RedString("Failed to validate: %s", err.Error()), 1)
+	}
+
+	if c.Bool("mappings") {
+		mappingIssues, err := e.ValidateMappings()
+		if err != nil {
+			return cli.NewExitError(color.RedString("Failed to validate mappings: %s", err.Error()), 1)
+		}
+		issues = append(issues, mappingIssues...)
+	}
+
+	errs := 0
+	warnings := 0
+	for _, v := range issues {
+		if v.Warning {
+			warnings++
+			color.Yellow("%s", v.Error())
+		} else {
+			errs++
+			color.Red("%s", v.Error())
+		}
+	}
+
+	if errs > 0 || (warnings > 0 && !c.Bool("allow-warnings")) {
+		return cli.NewExitError(color.RedString("Found %d errors and %d warnings", errs, warnings), 1)
+	}
+
+	if warnings > 0 {
+		color.Yellow("Found %d warnings", warnings)
+	} else {
+		color.Green("All data templates are valid")
+	}
+
+	return nil
+}
@@ -0,0 +1,469 @@
+package esdt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The actions taken to bring a resource in line with its declaration
+const (
+	ResourceCreate = "create"
+	ResourceUpdate = "update"
+	ResourceDelete = "delete"
+)
+
+// The field of _meta which marks a resource as managed by esdt, so that it can be pruned once
+// its declaration is removed
+const ManagedByMetaField = "managed_by"
+const ManagedByMetaValue = "esdt"
+
+// A kind of resource which can be declared in the ResourcesDir
+type resourceKind struct {
+	// The subdirectory of the ResourcesDir the resources are declared in
+	Dir string
+
+	// The API the resources are managed through, e.g. _index_template
+	Api string
+}
+
+// The kinds of resource in the order they are created, so that the resources others refer to
+// exist first. Resources are deleted in the reverse order.
+var resourceKinds = []resourceKind{
+	{Dir: "component_templates", Api: "_component_template"},
+	{Dir: "ilm_policies", Api: "_ilm/policy"},
+	{Dir: "pipelines", Api: "_ingest/pipeline"},
+	{Dir: "legacy_templates", Api: "_template"},
+	{Dir: "index_templates", Api: "_index_template"},
+	{Dir: "aliases", Api: "_alias"},
+}
+
+// A change needed to bring a resource in the cluster in line with its declaration
+type ResourceChange struct {
+	// The subdirectory of the ResourcesDir for the kind of resource, e.g. index_templates
+	Kind string
+
+	// The name of the resource
+	Name string
+
+	// Either create, update or delete
+	Action string
+
+	kind    resourceKind
+	body    map[string]interface{}
+	current map[string]interface{}
+}
+
+func (c *ResourceChange) String() string {
+	return fmt.Sprintf("%s %s/%s", c.Action, c.Kind, c.Name)
+}
+
+func (e *esdtImpl) PlanResources(prune bool) ([]*ResourceChange, error) {
+	return e.PlanResourcesContext(context.Background(), prune)
+}
+
+func (e *esdtImpl) PlanResourcesContext(ctx context.Context, prune bool) ([]*ResourceChange, error) {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	return e.planResources(prune)
+}
+
+func (e *esdtImpl) Apply(prune bool) ([]*ResourceChange, error) {
+	return e.ApplyContext(context.Background(), prune)
+}
+
+func (e *esdtImpl) ApplyContext(ctx context.Context, prune bool) ([]*ResourceChange, error) {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	changes, err := e.planResources(prune)
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []*ResourceChange
+	for _, v := range changes {
+		err = e.applyResourceChange(v)
+		if err != nil {
+			return applied, errors.Wrap(err, fmt.Sprintf("Could not %s", v.String()))
+		}
+		applied = append(applied, v)
+	}
+
+	return applied, nil
+}
+
+func (e *esdtImpl) planResources(prune bool) ([]*ResourceChange, error) {
+	declared, err := e.loadResources()
+	if err != nil {
+		return nil, err
+	}
+
+	err = e.waitForCluster()
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []*ResourceChange
+	var deletes []*ResourceChange
+	for _, kind := range resourceKinds {
+		// Kinds which are not declared are only read to prune them, so that apply works on
+		// clusters without the APIs for them
+		if len(declared[kind.Dir]) == 0 && !prune {
+			continue
+		}
+
+		current, err := e.currentResources(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range sortedNames(declared[kind.Dir]) {
+			body := declared[kind.Dir][name]
+			change := &ResourceChange{Kind: kind.Dir, Name: name, kind: kind, body: body, current: current[name]}
+			if current[name] == nil {
+				change.Action = ResourceCreate
+			} else if resourceChanged(kind, body, current[name]) {
+				change.Action = ResourceUpdate
+			} else {
+				continue
+			}
+			changes = append(changes, change)
+		}
+
+		if !prune {
+			continue
+		}
+		for _, name := range sortedNames(current) {
+			if _, ok := declared[kind.Dir][name]; ok || !managedByEsdt(kind, current[name]) {
+				continue
+			}
+			deletes = append([]*ResourceChange{{Kind: kind.Dir, Name: name, Action: ResourceDelete, kind: kind}}, deletes...)
+		}
+	}
+
+	return append(changes, deletes...), nil
+}
+
+// Loads the resources declared in the ResourcesDir, keyed by the kind and then the name of
+// each resource. The esdt marker is added to each body.
+func (e *esdtImpl) loadResources() (map[string]map[string]map[string]interface{}, error) {
+	fsys := e.Config.files()
+	dir := e.Config.fsPath(e.Config.ResourcesDir)
+	info, err := fs.Stat(fsys, dir)
+	if err != nil || !info.IsDir() {
+		return nil, errors.New(fmt.Sprintf("Could not find directory %s", e.Config.ResourcesDir))
+	}
+
+	declared := make(map[string]map[string]map[string]interface{})
+	var errs LoadErrors
+	for _, kind := range resourceKinds {
+		kindDir := path.Join(dir, kind.Dir)
+		entries, err := fs.ReadDir(fsys, kindDir)
+		if err != nil {
+			continue
+		}
+
+		declared[kind.Dir] = make(map[string]map[string]interface{})
+		for _, v := range entries {
+			rel := path.Join(kind.Dir, v.Name())
+			if v.IsDir() || e.excluded(path.Join(dir, rel), rel) {
+				continue
+			}
+
+			body, err := e.loadResourceFile(dir, rel)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			name := operationId(v.Name())
+			if _, ok := declared[kind.Dir][name]; ok {
+				errs = append(errs, errors.New(fmt.Sprintf("Duplicate resource %s/%s", kind.Dir, name)))
+				continue
+			}
+			if markable(kind) {
+				markManaged(kind, body)
+			}
+			declared[kind.Dir][name] = body
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return declared, nil
+}
+
+// Loads the body of a resource from a JSON or YAML file, resolving the files it includes
+func (e *esdtImpl) loadResourceFile(dir string, rel string) (map[string]interface{}, error) {
+	fp := path.Join(dir, rel)
+	if !OperationRegEx.MatchString(rel) {
+		return nil, errors.New(fmt.Sprintf("invalid resource %s, expected a .json, .yml or .yaml file", fp))
+	}
+
+	content, err := fs.ReadFile(e.Config.files(), fp)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Problems reading file %s", fp))
+	}
+
+	raw := content
+	if YamlRegEx.MatchString(rel) {
+		raw, err = yamlToJson(content)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Could not parse file %s, double check your YAML: %s", fp, err.Error()))
+		}
+	}
+
+	var body map[string]interface{}
+	err = json.Unmarshal(raw, &body)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse file %s, double check your %s: %s", fp, operationFormat(rel), describeDecodeError(rel, raw, err)))
+	}
+
+	r := &includeResolver{fsys: e.Config.files(), dir: dir, stack: []string{rel}}
+	body, err = r.resolveBody(body)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not load file %s", fp))
+	}
+	if body == nil {
+		body = make(map[string]interface{})
+	}
+
+	return body, nil
+}
+
+// Fetches every resource of a kind from the cluster, keyed by name
+func (e *esdtImpl) currentResources(kind resourceKind) (map[string]map[string]interface{}, error) {
+	res, err := e.runEsQuery(kind.Api, "get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("did not receive a response from elasticsearch")
+	}
+
+	// Elasticsearch responds with a 404 when there are no pipelines, and with a 400 when the
+	// version of the cluster does not have the API, e.g. _component_template before 7.8
+	if res.Response().StatusCode == http.StatusNotFound || unsupportedApi(res.Response().StatusCode, res.String()) {
+		return map[string]map[string]interface{}{}, nil
+	}
+	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
+		return nil, errors.New(fmt.Sprintf("Could not fetch %s: %s", kind.Dir, res.Response().Status))
+	}
+
+	var state map[string]interface{}
+	err = res.ToJSON(&state)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse %s from elasticsearch", kind.Dir))
+	}
+
+	if kind.Api == "_alias" {
+		return parseAliases(state), nil
+	}
+	return parseResources(kind.Api, state), nil
+}
+
+// Whether Elasticsearch rejected a request because it does not have the API. Without a
+// handler, paths starting with an underscore are read as index names.
+func unsupportedApi(status int, body string) bool {
+	return status == http.StatusBadRequest &&
+		(strings.Contains(body, "no handler found") || strings.Contains(body, "invalid_index_name_exception"))
+}
+
+// Regroups the response to GET _alias, which is keyed by index, into the declaration of each
+// alias: { "indices": { "<index>": { <alias options> } } }
+func parseAliases(state map[string]interface{}) map[string]map[string]interface{} {
+	aliases := make(map[string]map[string]interface{})
+	for index, v := range state {
+		item, _ := v.(map[string]interface{})
+		names, _ := item["aliases"].(map[string]interface{})
+		for name, options := range names {
+			if aliases[name] == nil {
+				aliases[name] = map[string]interface{}{"indices": map[string]interface{}{}}
+			}
+			aliases[name]["indices"].(map[string]interface{})[index] = options
+		}
+	}
+	return aliases
+}
+
+func (e *esdtImpl) applyResourceChange(change *ResourceChange) error {
+	if change.kind.Api == "_alias" {
+		return e.runEsQueryAndValidate("_aliases", "post", aliasActions(change.Name, change.body, change.current))
+	}
+
+	uri := change.kind.Api + "/" + url.PathEscape(change.Name)
+	if change.Action == ResourceDelete {
+		return e.runEsQueryAndValidate(uri, "delete", nil)
+	}
+	return e.runEsQueryAndValidate(uri, "put", change.body)
+}
+
+func resourceChanged(kind resourceKind, desired map[string]interface{}, current map[string]interface{}) bool {
+	if kind.Api == "_alias" {
+		actions, _ := aliasActions("", desired, current)["actions"].([]interface{})
+		return len(actions) > 0
+	}
+	return !sameDefinition(desired, current)
+}
+
+// The actions which point an alias at the declared indices with their options, and remove it
+// from any other index
+func aliasActions(name string, desired map[string]interface{}, current map[string]interface{}) map[string]interface{} {
+	want, _ := desired["indices"].(map[string]interface{})
+	have, _ := current["indices"].(map[string]interface{})
+
+	var actions []interface{}
+	for _, index := range sortedKeys(want) {
+		options, _ := want[index].(map[string]interface{})
+		existing, _ := have[index].(map[string]interface{})
+		if _, ok := have[index]; ok && sameDefinition(options, existing) {
+			continue
+		}
+
+		add := map[string]interface{}{"index": index, "alias": name}
+		for k, v := range options {
+			add[k] = v
+		}
+		actions = append(actions, map[string]interface{}{"add": add})
+	}
+	for _, index := range sortedKeys(have) {
+		if _, ok := want[index]; !ok {
+			actions = append(actions, map[string]interface{}{"remove": map[string]interface{}{"index": index, "alias": name}})
+		}
+	}
+
+	return map[string]interface{}{"actions": actions}
+}
+
+// The _meta of a resource, which is within the policy for ILM policies
+func resourceMeta(kind resourceKind, body map[string]interface{}) map[string]interface{} {
+	if kind.Api == "_ilm/policy" {
+		body, _ = body["policy"].(map[string]interface{})
+	}
+	meta, _ := body["_meta"].(map[string]interface{})
+	return meta
+}
+
+// Whether a kind of resource can carry the esdt marker in its _meta. Legacy templates would
+// read _meta as a mapping type.
+func markable(kind resourceKind) bool {
+	return kind.Api != "_alias" && kind.Api != "_template"
+}
+
+func markManaged(kind resourceKind, body map[string]interface{}) {
+	target := body
+	if kind.Api == "_ilm/policy" {
+		policy, ok := body["policy"].(map[string]interface{})
+		if !ok {
+			policy = make(map[string]interface{})
+			body["policy"] = policy
+		}
+		target = policy
+	}
+
+	meta, ok := target["_meta"].(map[string]interface{})
+	if !ok {
+		meta = make(map[string]interface{})
+		target["_meta"] = meta
+	}
+	meta[ManagedByMetaField] = ManagedByMetaValue
+}
+
+// Whether a resource in the cluster carries the esdt marker. Aliases and legacy templates
+// cannot carry it, so are never pruned.
+func managedByEsdt(kind resourceKind, body map[string]interface{}) bool {
+	if !markable(kind) {
+		return false
+	}
+	return resourceMeta(kind, body)[ManagedByMetaField] == ManagedByMetaValue
+}
+
+// Values Elasticsearch fills in when they are left out of a declaration
+var defaultDefinitionValues = map[string]string{
+	"min_age": "0ms",
+	"order":   "0",
+}
+
+// Whether a declared resource matches the resource in the cluster. Elasticsearch returns
+// settings nested and scalar settings as strings, so definitions are compared flattened
+// with their values as strings.
+func sameDefinition(desired map[string]interface{}, current map[string]interface{}) bool {
+	want := make(map[string]string)
+	have := make(map[string]string)
+	flattenDefinition("", desired, want)
+	flattenDefinition("", current, have)
+
+	for k, v := range want {
+		if h, ok := have[k]; !ok || h != v {
+			return false
+		}
+	}
+	for k, v := range have {
+		if _, ok := want[k]; ok {
+			continue
+		}
+		if defaultDefinitionValues[k[strings.LastIndex(k, ".")+1:]] != v {
+			return false
+		}
+	}
+	return true
+}
+
+func flattenDefinition(prefix string, v interface{}, out map[string]string) {
+	key := func(k string) string {
+		if prefix == "" {
+			return k
+		}
+		return prefix + "." + k
+	}
+
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, child := range t {
+			if settings, ok := child.(map[string]interface{}); ok && k == "settings" {
+				flat := make(map[string]interface{})
+				flattenSettings("", settings, flat)
+				for sk, sv := range flat {
+					flattenDefinition(key(k)+"."+sk, sv, out)
+				}
+				continue
+			}
+			flattenDefinition(key(k), child, out)
+		}
+	case []interface{}:
+		for i, child := range t {
+			flattenDefinition(key(strconv.Itoa(i)), child, out)
+		}
+	default:
+		out[prefix] = fmt.Sprint(t)
+	}
+}
+
+func sortedNames(resources map[string]map[string]interface{}) []string {
+	names := make([]string, 0, len(resources))
+	for k := range resources {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,42 @@
+package esdt
+
+import (
+	"encoding/base64"
+	"github.com/imroc/req"
+	"strings"
+)
+
+// The headers sent with a request, which authenticate it against the Elasticsearch cluster.
+// The given headers take precedence over the Headers in the Config, and an API key takes
+// precedence over a bearer token, which takes precedence over a username and password.
+func (e *esdtImpl) requestHeaders(headers map[string]string) req.Header {
+	header := req.Header{}
+	for k, v := range e.Config.Headers {
+		header[k] = v
+	}
+	for k, v := range headers {
+		header[k] = v
+	}
+
+	switch {
+	case e.Config.AuthMode == AuthModeAwsSigV4:
+		// The request is signed by the transport
+	case e.Config.ApiKey != "":
+		header["Authorization"] = "ApiKey " + encodeApiKey(e.Config.ApiKey)
+	case e.Config.BearerToken != "":
+		header["Authorization"] = "Bearer " + e.Config.BearerToken
+	case e.Config.Username != "" || e.Config.Password != "":
+		credentials := e.Config.Username + ":" + e.Config.Password
+		header["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials))
+	}
+
+	return header
+}
+
+// API keys can be given either as the encoded key Elasticsearch returns or as id:api_key
+func encodeApiKey(key string) string {
+	if strings.Contains(key, ":") {
+		return base64.StdEncoding.EncodeToString([]byte(key))
+	}
+	return key
+}
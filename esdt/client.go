@@ -0,0 +1,136 @@
+package esdt
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/imroc/req"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Builds the client shared by every request esdt makes to the Elasticsearch cluster. The
+// HttpClient or Transport in the Config are used if given.
+func newClient(c *Config) (*req.Req, error) {
+	client := &http.Client{
+		Timeout: 2 * time.Minute,
+	}
+	if c.HttpClient != nil {
+		client = &http.Client{
+			Transport:     c.HttpClient.Transport,
+			CheckRedirect: c.HttpClient.CheckRedirect,
+			Jar:           c.HttpClient.Jar,
+			Timeout:       c.HttpClient.Timeout,
+		}
+		if client.Transport == nil {
+			client.Transport = http.DefaultTransport
+		}
+	} else if c.Transport != nil {
+		client.Transport = c.Transport
+	} else {
+		transport, err := newTransport(c)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+
+	if c.AuthMode == AuthModeAwsSigV4 {
+		transport, err := newSigV4Transport(c, client.Transport)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	} else if c.AuthMode != "" {
+		return nil, errors.New(fmt.Sprintf("Invalid auth mode %s", c.AuthMode))
+	}
+
+	r := req.New()
+	r.SetClient(client)
+	return r, nil
+}
+
+func newTransport(c *Config) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(c)
+	if err != nil {
+		return nil, err
+	}
+
+	proxy, err := proxyFunc(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}, nil
+}
+
+func newTLSConfig(c *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.Insecure,
+	}
+
+	if c.CACert != "" {
+		pem, err := ioutil.ReadFile(c.CACert)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Problems reading CA certificate %s", c.CACert))
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New(fmt.Sprintf("No certificates found in CA certificate %s", c.CACert))
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if c.ClientCert == "" || c.ClientKey == "" {
+			return nil, errors.New("Both a client certificate and client key are required")
+		}
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Problems loading client certificate %s: %s", c.ClientCert, err.Error()))
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// The client for a single request, which binds the request to the esdt's context
+func (e *esdtImpl) httpClient() *http.Client {
+	base := e.client.Client()
+	return &http.Client{
+		Transport: &contextTransport{
+			ctx:  e.ctx,
+			base: base.Transport,
+		},
+		CheckRedirect: base.CheckRedirect,
+		Jar:           base.Jar,
+		Timeout:       base.Timeout,
+	}
+}
+
+// Binds every request to a context, as req does not accept one
+type contextTransport struct {
+	ctx  context.Context
+	base http.RoundTripper
+}
+
+func (t *contextTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(r.WithContext(t.ctx))
+}
@@ -1,9 +1,36 @@
 package esdt
 
-import "regexp"
+import (
+	"regexp"
+	"time"
+)
 
 const DefaultConnUrl = "http://localhost:9200"
 const DefaultTargetDir = "es/operations"
 const DefaultConfigFile = "es/config.yml"
+const DefaultResourcesDir = "es/resources"
+const DefaultMaxAttempts = 3
+const DefaultRetryBackoff = 100 * time.Millisecond
+const DefaultRetryMaxBackoff = 10 * time.Second
+const DefaultWaitForStatus = "yellow"
+
+// The index esdt records the operations which have run in
+const OperationsIndex = "operations"
+
+// The RollbackTemplate Mode which derives the rollback from the Operation
+const RollbackModeAuto = "auto"
+
+// The files in the TargetDir which are never loaded as operations
+var DefaultExclude = []string{".*", "*.md"}
 
 var JsonRegEx = regexp.MustCompile(".+\\.json")
+var YamlRegEx = regexp.MustCompile(".+\\.ya?ml$")
+
+// Matches the filenames of operations, which may be written in JSON or YAML
+var OperationRegEx = regexp.MustCompile(".+\\.(json|ya?ml)$")
+
+// The AuthMode which signs requests with AWS Signature Version 4, for Amazon OpenSearch Service
+const AuthModeAwsSigV4 = "aws-sigv4"
+
+// The AWS service requests are signed for by default
+const DefaultAwsService = "es"
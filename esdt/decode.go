@@ -0,0 +1,171 @@
+package esdt
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/go-yaml/yaml"
+)
+
+// Parses the contents of an operation file, written in JSON or YAML depending on its
+// extension. If strict is set, fields which are not part of an Operation are an error.
+func decodeOperation(filename string, content []byte, operation *Operation, strict bool) error {
+	if YamlRegEx.MatchString(filename) {
+		j, err := yamlToJson(content)
+		if err != nil {
+			return err
+		}
+		content = j
+	}
+
+	d := json.NewDecoder(bytes.NewReader(content))
+	if strict {
+		d.DisallowUnknownFields()
+	}
+	return d.Decode(operation)
+}
+
+// The order the fields of an operation and its rollback are written in by EncodeOperation
+var operationFieldOrder = []string{"method", "uri", "params", "headers", "body", "rollback", "mode", "snapshot", "snapshot_indices", "retry_safe", "timeout"}
+
+// Writes an operation in JSON or YAML depending on the extension of the filename, with the
+// method and uri first. The Id is not written, since it is taken from the filename.
+func EncodeOperation(filename string, operation *Operation) ([]byte, error) {
+	content, err := json.Marshal(operation)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(content, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	if YamlRegEx.MatchString(filename) {
+		return yaml.Marshal(orderFields(fields))
+	}
+
+	var buf bytes.Buffer
+	err = writeJsonFields(&buf, orderFields(fields), "")
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// Orders the fields of an operation and its rollback, leaving out those which are empty
+func orderFields(fields map[string]interface{}) yaml.MapSlice {
+	ordered := yaml.MapSlice{}
+	for _, k := range operationFieldOrder {
+		v, ok := fields[k]
+		if !ok || v == nil {
+			continue
+		}
+		if m, ok := v.(map[string]interface{}); ok && k == "rollback" {
+			v = orderFields(m)
+		}
+		ordered = append(ordered, yaml.MapItem{Key: k, Value: v})
+	}
+	return ordered
+}
+
+func writeJsonFields(buf *bytes.Buffer, fields yaml.MapSlice, indent string) error {
+	if len(fields) == 0 {
+		buf.WriteString("{}")
+		return nil
+	}
+
+	buf.WriteString("{\n")
+	for i, v := range fields {
+		if i > 0 {
+			buf.WriteString(",\n")
+		}
+		buf.WriteString(fmt.Sprintf("%s  %q: ", indent, v.Key))
+
+		if nested, ok := v.Value.(yaml.MapSlice); ok {
+			err := writeJsonFields(buf, nested, indent+"  ")
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, err := json.MarshalIndent(v.Value, indent+"  ", "  ")
+		if err != nil {
+			return err
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("\n" + indent + "}")
+	return nil
+}
+
+// Describes the error from decodeOperation, including the line and column of JSON errors.
+// YAML errors already include the line.
+func describeDecodeError(filename string, content []byte, err error) string {
+	if YamlRegEx.MatchString(filename) {
+		return err.Error()
+	}
+
+	var offset int64
+	switch t := err.(type) {
+	case *json.SyntaxError:
+		offset = t.Offset
+	case *json.UnmarshalTypeError:
+		offset = t.Offset
+	default:
+		return err.Error()
+	}
+
+	line, column := 1, 1
+	// The offset is just past the character the error was found at
+	for i := int64(0); i < offset-1 && i < int64(len(content)); i++ {
+		if content[i] == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return fmt.Sprintf("line %d, column %d: %s", line, column, err.Error())
+}
+
+// The format of an operation file, as named in error messages
+func operationFormat(filename string) string {
+	if YamlRegEx.MatchString(filename) {
+		return "yaml"
+	}
+	return "json"
+}
+
+// Converts YAML to JSON so that YAML operations share the field names of JSON operations,
+// and their bodies can be sent as JSON
+func yamlToJson(in []byte) ([]byte, error) {
+	var v interface{}
+	err := yaml.Unmarshal(in, &v)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(jsonCompatible(v))
+}
+
+// Converts the maps decoded from YAML, whose keys may be of any type, to maps with
+// string keys
+func jsonCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[fmt.Sprintf("%v", k)] = jsonCompatible(v)
+		}
+		return m
+	case []interface{}:
+		for i, v := range t {
+			t[i] = jsonCompatible(v)
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,220 @@
+package esdt
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// An operation file found in one of the target directories
+type operationFile struct {
+	// The target directory the file was found in
+	Dir string
+
+	// The slash separated path of the file relative to Dir, including the extension
+	Path string
+}
+
+// The id of the operation, which is its path relative to the target directory without
+// the extension, e.g. users/20181101000000_create_users
+func (f operationFile) Id() string {
+	return operationId(f.Path)
+}
+
+// The path of the file within the file system of the Config
+func (f operationFile) FullPath() string {
+	return path.Join(f.Dir, f.Path)
+}
+
+// The directories operations are loaded from. TargetDirs takes precedence over TargetDir,
+// which may hold a comma separated list.
+func (c *Config) Directories() []string {
+	dirs := c.TargetDirs
+	if len(dirs) == 0 {
+		dirs = strings.Split(c.TargetDir, ",")
+	}
+
+	var trimmed []string
+	for _, v := range dirs {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			trimmed = append(trimmed, v)
+		}
+	}
+	return trimmed
+}
+
+// Finds every file in the target directories and their subdirectories, other than those
+// excluded. The operation files are returned in the order they run, which is by filename
+// regardless of the directory they are in, followed by the files which are not operations.
+func (e *esdtImpl) discover() ([]operationFile, []operationFile, error) {
+	var files []operationFile
+	var others []operationFile
+
+	fsys := e.Config.files()
+	for _, v := range e.Config.Directories() {
+		dir := e.Config.fsPath(v)
+		info, err := fs.Stat(fsys, dir)
+		if err != nil || !info.IsDir() {
+			return nil, nil, errors.New(fmt.Sprintf("Could not find directory %s", v))
+		}
+
+		err = fs.WalkDir(fsys, dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p == dir {
+				return nil
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(p, dir), "/")
+
+			if e.excluded(p, rel) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+
+			f := operationFile{Dir: dir, Path: rel}
+			if OperationRegEx.MatchString(rel) {
+				files = append(files, f)
+			} else {
+				others = append(others, f)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("Could not read directory %s: %s", v, err.Error()))
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := path.Base(files[i].Path), path.Base(files[j].Path)
+		if a != b {
+			return a < b
+		}
+		return files[i].Path < files[j].Path
+	})
+
+	return files, others, nil
+}
+
+// Whether a file is ignored when discovering operations. The patterns are matched against
+// both the name of the file and its path relative to the target directory.
+func (e *esdtImpl) excluded(fullPath string, rel string) bool {
+	if e.Config.isConfigFile(fullPath) {
+		return true
+	}
+	for _, v := range append(DefaultExclude, e.Config.Exclude...) {
+		if matched, _ := path.Match(v, path.Base(rel)); matched {
+			return true
+		}
+		if matched, _ := path.Match(v, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// The files which share an id with another file, keyed by the id
+func duplicateIds(files []operationFile) (map[string][]operationFile, []string) {
+	byId := make(map[string][]operationFile)
+	for _, v := range files {
+		byId[v.Id()] = append(byId[v.Id()], v)
+	}
+
+	duplicates := make(map[string][]operationFile)
+	var ids []string
+	for k, v := range byId {
+		if len(v) > 1 {
+			duplicates[k] = v
+			ids = append(ids, k)
+		}
+	}
+	sort.Strings(ids)
+	return duplicates, ids
+}
+
+// Finds the file of an operation from its id or filename. The extension may be left out, and
+// an operation in a subdirectory may be referred to by its filename alone if it is unique.
+func (e *esdtImpl) findOperationFile(name string) (operationFile, error) {
+	name = filepath.ToSlash(strings.TrimSpace(name))
+	candidates := []string{name}
+	if !OperationRegEx.MatchString(name) {
+		candidates = []string{name + ".json", name + ".yml", name + ".yaml"}
+	}
+
+	for _, dir := range e.Config.Directories() {
+		for _, v := range candidates {
+			f := operationFile{Dir: e.Config.fsPath(dir), Path: v}
+			if info, err := fs.Stat(e.Config.files(), f.FullPath()); err == nil && !info.IsDir() {
+				return f, nil
+			}
+		}
+	}
+
+	files, _, err := e.discover()
+	if err != nil {
+		return operationFile{}, err
+	}
+
+	id := operationId(name)
+	var matches []operationFile
+	for _, v := range files {
+		if path.Base(v.Id()) == id {
+			matches = append(matches, v)
+		}
+	}
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return operationFile{}, errors.New(fmt.Sprintf("Operation %s is ambiguous, it could be %s", name, joinPaths(matches)))
+	}
+	return operationFile{}, errors.New(fmt.Sprintf("Could not find operation %s in %s", name, strings.Join(e.Config.Directories(), ", ")))
+}
+
+// The id of the operation with the given id or filename, resolved against the operation files
+func (e *esdtImpl) resolveId(name string) string {
+	f, err := e.findOperationFile(name)
+	if err != nil {
+		return operationId(name)
+	}
+	return f.Id()
+}
+
+// Removes the files included by operations, given by their paths within the file system
+func withoutIncluded(files []operationFile, included map[string]bool) []operationFile {
+	var kept []operationFile
+	for _, v := range files {
+		if !included[v.FullPath()] {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func joinPaths(files []operationFile) string {
+	paths := make([]string, len(files))
+	for i, v := range files {
+		paths[i] = v.FullPath()
+	}
+	return strings.Join(paths, ", ")
+}
+
+// Removes the file extension from an operation filename
+func operationId(filename string) string {
+	filename = strings.TrimSpace(filename)
+	if OperationRegEx.MatchString(filename) {
+		return strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+	return filename
+}
@@ -0,0 +1,254 @@
+package esdt
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-yaml/yaml"
+	"github.com/pkg/errors"
+	"io/fs"
+	"sort"
+	"strings"
+)
+
+// The value of a DriftItem for a resource or field which does not exist in an environment
+const DriftMissing = "(missing)"
+
+// A difference in a managed resource between two environments
+type DriftItem struct {
+	// The kind and name of the resource, e.g. index users or index_template users
+	Resource string
+
+	// The dotted path of the field which differs, or empty if the resource only exists in
+	// one of the environments
+	Field string
+
+	// The value in the environment of the esdt and in the environment compared against
+	Value        string
+	AgainstValue string
+}
+
+func (d *DriftItem) String() string {
+	if d.Field == "" {
+		return fmt.Sprintf("%s: %s != %s", d.Resource, d.Value, d.AgainstValue)
+	}
+	return fmt.Sprintf("%s: %s: %s != %s", d.Resource, d.Field, d.Value, d.AgainstValue)
+}
+
+func (e *esdtImpl) Drift(against string) ([]*DriftItem, error) {
+	return e.DriftContext(context.Background(), against)
+}
+
+func (e *esdtImpl) DriftContext(ctx context.Context, against string) ([]*DriftItem, error) {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	if e.initErr != nil {
+		return nil, e.initErr
+	}
+
+	err := e.Config.checkEnv(against)
+	if err != nil {
+		return nil, err
+	}
+
+	other := New(&Config{
+		ConfigFile: e.Config.ConfigFile,
+		Env:        against,
+		FS:         e.Config.FS,
+	}).(*esdtImpl).withContext(e.ctx)
+	if other.initErr != nil {
+		return nil, other.initErr
+	}
+
+	indices, resources, err := e.managedResources()
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := e.managedState(indices, resources)
+	if err != nil {
+		return nil, err
+	}
+	otherState, err := other.managedState(indices, resources)
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("Could not read %s", against))
+	}
+
+	return diffStates(state, otherState), nil
+}
+
+// Returns an error if the environment is not in the ConfigFile
+func (c *Config) checkEnv(env string) error {
+	content, err := fs.ReadFile(c.files(), c.fsPath(c.ConfigFile))
+	if err != nil {
+		return errors.New(fmt.Sprintf("Could not read config file %s", c.ConfigFile))
+	}
+
+	var yc yamlConfig
+	err = yaml.Unmarshal(content, &yc)
+	if err != nil {
+		return errors.New(fmt.Sprintf("Could not parse config file %s", c.ConfigFile))
+	}
+
+	if _, ok := yc[env]; !ok {
+		return errors.New(fmt.Sprintf("Environment %s is not in %s", env, c.ConfigFile))
+	}
+	return nil
+}
+
+// The indices and resources targeted by the operations in the TargetDir and declared in the
+// ResourcesDir. Resources are keyed by their API, e.g. _index_template/users.
+func (e *esdtImpl) managedResources() ([]string, map[string]bool, error) {
+	operations, err := e.loadAll()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	indices := make(map[string]bool)
+	resources := make(map[string]bool)
+	for _, v := range operations {
+		p := uriPath(v.Uri)
+		segments := strings.Split(p, "/")
+
+		switch {
+		case overwritableResource(p) != "":
+			resources[p] = true
+		case p == "_aliases":
+			actions, _ := v.Body["actions"].([]interface{})
+			for _, a := range actions {
+				action, _ := a.(map[string]interface{})
+				for _, options := range action {
+					o, _ := options.(map[string]interface{})
+					if index, ok := o["index"].(string); ok {
+						indices[index] = true
+					}
+				}
+			}
+		case p != "" && !strings.HasPrefix(segments[0], "_"):
+			indices[segments[0]] = true
+		}
+	}
+
+	if _, err := fs.Stat(e.Config.files(), e.Config.fsPath(e.Config.ResourcesDir)); err == nil {
+		declared, err := e.loadResources()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, kind := range resourceKinds {
+			for name := range declared[kind.Dir] {
+				resources[kind.Api+"/"+name] = true
+			}
+		}
+	}
+
+	var names []string
+	for k := range indices {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names, resources, nil
+}
+
+// Reads the definitions of the managed indices and resources, keyed by the kind and name of
+// each. Indices are read as they would be created, without the settings Elasticsearch sets.
+func (e *esdtImpl) managedState(indices []string, resources map[string]bool) (map[string]map[string]interface{}, error) {
+	state := make(map[string]map[string]interface{})
+
+	for _, kind := range resourceKinds {
+		wanted := false
+		for k := range resources {
+			if strings.HasPrefix(k, kind.Api+"/") {
+				wanted = true
+			}
+		}
+		if !wanted {
+			continue
+		}
+
+		current, err := e.currentResources(kind)
+		if err != nil {
+			return nil, err
+		}
+		for name, body := range current {
+			if resources[kind.Api+"/"+name] {
+				state[strings.TrimPrefix(kind.Api, "_")+" "+name] = body
+			}
+		}
+	}
+
+	if len(indices) > 0 {
+		current, err := e.exportIndices(strings.Join(indices, ","))
+		if err != nil {
+			return nil, err
+		}
+		for name, v := range current {
+			index, _ := v.(map[string]interface{})
+			state["index "+name] = indexBody(index)
+		}
+	}
+
+	return state, nil
+}
+
+// Compares the flattened definitions of each resource in two environments
+func diffStates(state map[string]map[string]interface{}, against map[string]map[string]interface{}) []*DriftItem {
+	var names []string
+	for k := range state {
+		names = append(names, k)
+	}
+	for k := range against {
+		if _, ok := state[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+
+	var items []*DriftItem
+	for _, name := range names {
+		a, inState := state[name]
+		b, inAgainst := against[name]
+		if !inState || !inAgainst {
+			item := &DriftItem{Resource: name, Value: "exists", AgainstValue: "exists"}
+			if !inState {
+				item.Value = DriftMissing
+			} else {
+				item.AgainstValue = DriftMissing
+			}
+			items = append(items, item)
+			continue
+		}
+
+		flatA := make(map[string]string)
+		flatB := make(map[string]string)
+		flattenDefinition("", a, flatA)
+		flattenDefinition("", b, flatB)
+
+		var fields []string
+		for k := range flatA {
+			fields = append(fields, k)
+		}
+		for k := range flatB {
+			if _, ok := flatA[k]; !ok {
+				fields = append(fields, k)
+			}
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			va, okA := flatA[field]
+			vb, okB := flatB[field]
+			if okA && okB && va == vb {
+				continue
+			}
+			if !okA {
+				va = DriftMissing
+			}
+			if !okB {
+				vb = DriftMissing
+			}
+			items = append(items, &DriftItem{Resource: name, Field: field, Value: va, AgainstValue: vb})
+		}
+	}
+
+	return items
+}
@@ -1,6 +1,9 @@
 package esdt
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/fatih/color"
@@ -8,27 +11,64 @@ import (
 	"github.com/pkg/errors"
 	"io/ioutil"
 	"net/url"
-	"path"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
 type operations struct {
 	InsertedAt time.Time `json:"inserted_at"`
+
+	// Set when the operation was marked as applied by Baseline rather than run
+	Baseline bool `json:"baseline,omitempty"`
+
+	// Set when the operation was marked as applied by hand rather than run
+	Manual bool `json:"manual,omitempty"`
+
+	// The state of the resource overwritten by an operation with an auto rollback, as
+	// returned by Elasticsearch before the operation ran
+	Previous string `json:"previous,omitempty"`
+
+	// The SHA-256 checksum of the operation as it ran, including the contents of the files
+	// it includes
+	Checksum string `json:"checksum,omitempty"`
+
+	// The snapshot taken before the operation ran and the repository it is stored in
+	Snapshot     string `json:"snapshot,omitempty"`
+	SnapshotRepo string `json:"snapshot_repo,omitempty"`
+
+	// The indices in the snapshot, which are restored by Restore
+	SnapshotIndices []string `json:"snapshot_indices,omitempty"`
+
+	// The indices the operation targeted which did not exist when the snapshot was taken,
+	// which are deleted by Restore
+	CreatedIndices []string `json:"created_indices,omitempty"`
 }
 
 type documentExistsRes struct {
 	Found bool `json:"found"`
 }
 
+type operationDocumentRes struct {
+	Found  bool       `json:"found"`
+	Source operations `json:"_source"`
+}
+
 const NoRollbackFieldErrorMsg = "No rollback listed"
 
+const RedoRollbackFailedMsg = "Rollback failed"
+
+const RedoRunFailedMsg = "Re-run failed"
+
+const ProtectedEnvErrorMsg = "The environment is protected, the change must be forced"
+
 type documentDeletedRes struct {
 	Result string `json:"result"`
 }
 
 func (e *esdtImpl) deleteOperationIndex(rollbackId string) error {
-	res, err := e.runEsQuery("operations/_doc/"+rollbackId, "delete", nil)
+	res, err := e.runEsQuery(operationRecordUri(rollbackId), "delete", nil)
 
 	if err != nil {
 		return err
@@ -46,30 +86,88 @@ func (e *esdtImpl) deleteOperationIndex(rollbackId string) error {
 	return nil
 }
 
+// The checksum of an operation, taken after the files it includes are resolved so that a
+// change to an included file changes the checksum
+func operationChecksum(operation *Operation) string {
+	o := *operation
+	o.Id = ""
+	// A missing body and an empty body send the same request
+	if len(o.Body) == 0 {
+		o.Body = nil
+	}
+	if len(o.Rollback.Body) == 0 {
+		o.Rollback.Body = nil
+	}
+	content, err := json.Marshal(o)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// The URI of the record of an operation. Ids of operations in subdirectories contain
+// slashes, which are escaped.
+func operationRecordUri(id string) string {
+	return OperationsIndex + "/_doc/" + url.PathEscape(id)
+}
+
 func (e *esdtImpl) createOperationsIndex() error {
-	body := "{ \"mappings\": { \"_doc\": { \"properties\": { \"inserted_at\": { \"type\": \"date\" } } } } }"
-	return e.runEsQueryAndValidate("operations", "put", body)
+	body := "{ \"mappings\": { \"_doc\": { \"properties\": { \"inserted_at\": { \"type\": \"date\" }, \"baseline\": { \"type\": \"boolean\" }, \"manual\": { \"type\": \"boolean\" }, \"previous\": { \"type\": \"text\", \"index\": false }, \"snapshot\": { \"type\": \"keyword\" }, \"snapshot_repo\": { \"type\": \"keyword\" }, \"checksum\": { \"type\": \"keyword\" }, \"snapshot_indices\": { \"type\": \"keyword\" }, \"created_indices\": { \"type\": \"keyword\" } } } } }"
+	return e.runEsQueryAndValidate(OperationsIndex, "put", body)
 }
 
-func (e *esdtImpl) operationsIndexExists() (bool, error) {
-	res, err := e.runEsQuery("operations", "head", nil)
+func (e *esdtImpl) ensureOperationsIndex() error {
+	err := e.waitForCluster()
+	if err != nil {
+		return err
+	}
 
-	if res == nil {
-		return false, errors.New("no response received from Elasticsearch")
+	ex, err := e.operationsIndexExists()
+	if err != nil {
+		return err
+	}
+
+	if !ex {
+		return e.createOperationsIndex()
 	}
 
+	return nil
+}
+
+func (e *esdtImpl) operationsIndexExists() (bool, error) {
+	res, err := e.runEsQuery(OperationsIndex, "head", nil)
+
 	if err != nil {
 		return false, err
 	}
 
+	if res == nil {
+		return false, errors.New("no response received from Elasticsearch")
+	}
+
 	return res.Response().StatusCode > 199 && res.Response().StatusCode < 300, nil
 }
 
 func (e *esdtImpl) rollbackDataTemplate(dt *Operation) error {
+	if dt.Rollback.Mode == RollbackModeAuto {
+		record, err := e.getOperationRecord(dt.Id)
+		if err != nil {
+			return err
+		}
+		err = e.runAutoRollback(dt, record.Previous)
+		if err != nil {
+			return err
+		}
+		return e.deleteOperationIndex(dt.Id)
+	}
+
 	if dt.Rollback.Uri == "" || dt.Rollback.Method == "" {
 		return errors.New(NoRollbackFieldErrorMsg)
 	} else {
-		err := e.runEsQueryAndValidate(dt.Rollback.Uri, dt.Rollback.Method, dt.Rollback.Body)
+		rollbackUri := withParams(dt.Rollback.Uri, dt.Rollback.Params)
+		retrySafe := idempotentMethod(dt.Rollback.Method)
+		err := validateEsResponse(e.runEsQueryWithRetry(rollbackUri, dt.Rollback.Method, dt.Rollback.Body, dt.Rollback.Headers, retrySafe))
 		if err != nil {
 			return err
 		}
@@ -77,8 +175,28 @@ func (e *esdtImpl) rollbackDataTemplate(dt *Operation) error {
 	}
 }
 
+func (e *esdtImpl) getOperationRecord(id string) (*operations, error) {
+	res, err := e.runEsQuery(operationRecordUri(id), "get", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res == nil {
+		return nil, errors.New("no response received from Elasticsearch")
+	}
+
+	var d operationDocumentRes
+	json.NewDecoder(res.Response().Body).Decode(&d)
+
+	if !d.Found {
+		return nil, errors.New(fmt.Sprintf("%s has not been run", id))
+	}
+
+	return &d.Source, nil
+}
+
 func (e *esdtImpl) operationsDocumentExists(id string) bool {
-	res, err := e.runEsQuery("operations/_doc/"+id, "get", nil)
+	res, err := e.runEsQuery(operationRecordUri(id), "get", nil)
 
 	if res == nil || err != nil {
 		return false
@@ -95,6 +213,13 @@ func (e *esdtImpl) executeDataTemplates(dataTemplates []*Operation) ([]*Operatio
 	errs := make([]error, 0)
 
 	for _, v := range dataTemplates {
+		if e.ctx.Err() != nil {
+			color.Red("%s was not run: %s", v.Id, e.ctx.Err().Error())
+			failed = append(failed, v)
+			errs = append(errs, e.ctx.Err())
+			continue
+		}
+
 		err := e.executeDataTemplate(v)
 		if err != nil {
 			failed = append(failed, v)
@@ -117,23 +242,64 @@ func (e *esdtImpl) executeDataTemplates(dataTemplates []*Operation) ([]*Operatio
 }
 
 func (e *esdtImpl) executeDataTemplate(operation *Operation) error {
+	timeout := e.Config.OperationTimeout
+	if operation.Timeout != "" {
+		t, err := time.ParseDuration(operation.Timeout)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Invalid timeout %s", operation.Timeout))
+		}
+		timeout = t
+	}
+	// The timeout only bounds the request itself. The snapshot, rollback and record are sent
+	// with the parent context, so that a slow request is still rolled back or recorded.
+	run := e
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(e.ctx, timeout)
+		defer cancel()
+		run = e.withContext(ctx)
+	}
+
 	if !e.operationsDocumentExists(operation.Id) {
-		err := e.runEsQueryAndValidate(operation.Uri, operation.Method, operation.Body)
+		var previous string
+		if operation.Rollback.Mode == RollbackModeAuto {
+			p, err := e.capturePreviousState(operation)
+			if err != nil {
+				return err
+			}
+			previous = p
+		}
 
 		operations := operations{
-			InsertedAt: time.Now(),
+			Checksum: operationChecksum(operation),
+			Previous: previous,
 		}
+		if repo := e.snapshotRepo(operation); repo != "" {
+			err := e.createSnapshot(operation, repo, &operations)
+			if err != nil {
+				return err
+			}
+		}
+
+		retrySafe := operation.RetrySafe || idempotentMethod(operation.Method)
+		uri := withParams(operation.Uri, operation.Params)
+		err := validateEsResponse(run.runEsQueryWithRetry(uri, operation.Method, operation.Body, operation.Headers, retrySafe))
+
+		operations.InsertedAt = time.Now()
 		if err != nil {
 			newError := errors.Wrap(err, "")
+			if operation.Rollback.Mode == RollbackModeAuto {
+				// A failed request leaves the resource untouched, so there is nothing to undo
+				return newError
+			}
 			err = e.rollbackDataTemplate(operation)
 			if err != nil {
 				newError = errors.Wrap(newError, "RollbackFile failed")
 			}
 			return newError
 		} else {
-			err = e.runEsQueryAndValidate("/operations/_doc/"+operation.Id, "post", &operations)
+			err = e.insertOperationRecord(operation.Id, &operations)
 			if err != nil {
-				return errors.New("Failed to add data template to operations")
+				return err
 			}
 		}
 	} else {
@@ -142,39 +308,196 @@ func (e *esdtImpl) executeDataTemplate(operation *Operation) error {
 	return nil
 }
 
-func (e *esdtImpl) runEsQuery(uri string, method string, bodyJson interface{}) (*req.Resp, error) {
-	r := req.New()
-	u, err := url.Parse(e.getConn())
+func (e *esdtImpl) insertOperationRecord(id string, record *operations) error {
+	// The record is indexed under the operation id, so it is safe to send again
+	err := validateEsResponse(e.runEsQueryWithRetry(operationRecordUri(id), "post", record, nil, true))
 	if err != nil {
+		return errors.New("Failed to add data template to operations")
+	}
+	return nil
+}
+
+// Records each operation as applied, returning the operations which could not be recorded
+func (e *esdtImpl) baselineDataTemplates(dataTemplates []*Operation) BaselineErrors {
+	var errs BaselineErrors
+	for _, v := range dataTemplates {
+		if e.operationsDocumentExists(v.Id) {
+			color.Yellow("%s has already run", v.Id)
+			continue
+		}
+
+		err := e.insertOperationRecord(v.Id, &operations{
+			InsertedAt: time.Now(),
+			Baseline:   true,
+		})
+		if err != nil {
+			color.Red("%s failed to baseline: %s", v.Id, err.Error())
+			errs = append(errs, errors.Wrap(err, v.Id))
+		} else {
+			color.Green("%s marked as applied", v.Id)
+		}
+	}
+	return errs
+}
+
+// The operations which could not be marked as applied by Baseline
+type BaselineErrors []error
+
+func (b BaselineErrors) Error() string {
+	messages := make([]string, len(b))
+	for i, v := range b {
+		messages[i] = v.Error()
+	}
+	return fmt.Sprintf("%d operations could not be marked as applied:\n%s", len(b), strings.Join(messages, "\n"))
+}
+
+func (e *esdtImpl) runEsQuery(uri string, method string, bodyJson interface{}) (*req.Resp, error) {
+	return e.runEsQueryWithRetry(uri, method, bodyJson, nil, idempotentMethod(method))
+}
+
+// Sends the query to each host in turn until it succeeds or the attempts are exhausted,
+// backing off once every host has been tried. Requests which failed after being sent
+// and responses from an overloaded cluster are only retried if retrySafe is set.
+func (e *esdtImpl) runEsQueryWithRetry(uri string, method string, bodyJson interface{}, headers map[string]string, retrySafe bool) (*req.Resp, error) {
+	if e.initErr != nil {
+		return nil, e.initErr
+	}
+
+	hosts := e.Config.hosts()
+	if len(hosts) == 0 {
 		return nil, errors.New("Invalid connection URL")
 	}
-	u.Path = path.Join(u.Path, uri)
-	esUrl := u.String()
-	body := req.BodyJSON(bodyJson)
+	attempts := e.Config.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	start := int(atomic.AddUint32(e.next, 1))
 
 	var res *req.Resp
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 && attempt%len(hosts) == 0 {
+			select {
+			case <-e.ctx.Done():
+			case <-time.After(e.Config.backoff(attempt / len(hosts))):
+			}
+		}
+		if e.ctx.Err() != nil {
+			if err == nil {
+				err = e.ctx.Err()
+			}
+			break
+		}
+
+		res, err = e.sendEsQuery(hosts[(start+attempt)%len(hosts)], uri, method, bodyJson, headers)
+		if err != nil {
+			if !retrySafe && !dialError(err) {
+				break
+			}
+			continue
+		}
+		if !retrySafe || !retryableStatusCodes[res.Response().StatusCode] {
+			break
+		}
+		if attempt < attempts-1 {
+			res.Response().Body.Close()
+		}
+	}
+
+	if err != nil {
+		return res, errors.New(e.Config.redact(err.Error()))
+	}
+
+	return res, nil
+}
+
+func (e *esdtImpl) sendEsQuery(host string, uri string, method string, bodyJson interface{}, headers map[string]string) (*req.Resp, error) {
+	r := e.client
+	esUrl, err := esQueryUrl(host, uri)
+	if err != nil {
+		return nil, err
+	}
+	body := req.BodyJSON(bodyJson)
+	header := e.requestHeaders(headers)
+	client := e.httpClient()
 
 	switch strings.ToLower(method) {
 	case "get":
-		res, err = r.Get(esUrl, body)
+		return r.Get(esUrl, header, body, client)
 	case "post":
-		res, err = r.Post(esUrl, body)
+		return r.Post(esUrl, header, body, client)
 	case "put":
-		res, err = r.Put(esUrl, body)
+		return r.Put(esUrl, header, body, client)
 	case "head":
-		res, err = r.Head(esUrl, body)
+		return r.Head(esUrl, header, body, client)
 	case "delete":
-		res, err = r.Delete(esUrl, body)
+		return r.Delete(esUrl, header, body, client)
 	default:
 		return nil, errors.New("Invalid HTTP method")
 	}
+}
 
-	return res, nil
+// Appends the URI to the host's path. The URI's escaping and query string are kept as given.
+func esQueryUrl(host string, uri string) (string, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", errors.New("Invalid connection URL")
+	}
+
+	if i := strings.Index(uri, "?"); i >= 0 {
+		u.RawQuery = uri[i+1:]
+		uri = uri[:i]
+	}
+
+	rawPath := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + strings.TrimPrefix(uri, "/")
+	p, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Invalid URI %s", uri))
+	}
+	u.Path = p
+	u.RawPath = rawPath
+
+	return u.String(), nil
+}
+
+// Adds the params to the query string of the URI. The params take precedence over the same
+// parameters in the URI.
+func withParams(uri string, params map[string]interface{}) string {
+	if len(params) == 0 {
+		return uri
+	}
+
+	query := ""
+	if i := strings.Index(uri, "?"); i >= 0 {
+		query = uri[i+1:]
+		uri = uri[:i]
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		values = url.Values{}
+	}
+	for k, v := range params {
+		values.Set(k, paramValue(v))
+	}
+
+	return uri + "?" + values.Encode()
+}
+
+// Formats a param as it is written in the query string. Numbers are decoded from JSON as
+// floats, which are written without an exponent so that e.g. 1000000 is not sent as 1e+06.
+func paramValue(v interface{}) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
 }
 
 func (e *esdtImpl) runEsQueryAndValidate(uri string, method string, bodyJson interface{}) error {
-	res, err := e.runEsQuery(uri, method, bodyJson)
+	return validateEsResponse(e.runEsQuery(uri, method, bodyJson))
+}
 
+func validateEsResponse(res *req.Resp, err error) error {
 	if err != nil {
 		return err
 	}
@@ -185,19 +508,8 @@ func (e *esdtImpl) runEsQueryAndValidate(uri string, method string, bodyJson int
 
 	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
 		bodyBytes, _ := ioutil.ReadAll(res.Response().Body)
-		errors.New(fmt.Sprintf("status code was not 200: %s. Reason: %s", res.Response().Status, string(bodyBytes)))
 		return errors.New(fmt.Sprintf("status code was not 200: %s. Reason: %s", res.Response().Status, string(bodyBytes)))
 	}
 
 	return nil
 }
-
-func (e *esdtImpl) getConn() (url string) {
-	strs := strings.Split(e.Config.Conn, "://")
-	if len(strs) == 1 {
-		url = fmt.Sprintf("%s:%s@%s", e.Config.Username, e.Config.Password, strs[0])
-	} else {
-		url = fmt.Sprintf("%s://%s:%s@%s", strs[0], e.Config.Username, e.Config.Password, strings.Join(strs[1:], ""))
-	}
-	return
-}
@@ -3,14 +3,17 @@
 package esdt
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
+	"github.com/fatih/color"
 	"github.com/go-yaml/yaml"
 	"github.com/imdario/mergo"
+	"github.com/imroc/req"
 	"github.com/pkg/errors"
-	"io/ioutil"
-	"path/filepath"
+	"io/fs"
+	"net/http"
 	"strings"
+	"time"
 )
 
 // A tool for seeding/migrating your Elasticsearch datastore. It can be used both as a CLI or a
@@ -25,6 +28,10 @@ type Esdt interface {
 	// subsequent Operations from running
 	RunAll() error
 
+	// Same as RunAll but the requests to Elasticsearch are bound to the context. Operations
+	// are no longer run once the context is done, and its error is returned.
+	RunAllContext(ctx context.Context) error
+
 	// Runs a specified Operation. If the operation has been run previously, no action is taken.
 	//
 	// If the operations index has not yet been created on the Elasticsearch, it is created here.
@@ -32,20 +39,150 @@ type Esdt interface {
 	// call Rollback(Operation) if an error is returned.
 	Run(operation *Operation) error
 
+	// Same as Run but the requests to Elasticsearch are bound to the context
+	RunContext(ctx context.Context, operation *Operation) error
+
 	// Same as Rollback but combines the steps of Load and Rollback
 	//
-	// The filename passed in must also contain the file extension (*.json)
+	// The file extension (*.json, *.yml or *.yaml) may be left out of the filename
 	RollbackFile(filename string) error
 
+	// Same as RollbackFile but the requests to Elasticsearch are bound to the context
+	RollbackFileContext(ctx context.Context, filename string) error
+
 	// Attempts to rollback any previously run Operation. If the operation
 	// has not yet been run, an error is returned
 	Rollback(operation *Operation) error
 
-	// Load an operation from the TargetDir into an Operation struct.
+	// Same as Rollback but the requests to Elasticsearch are bound to the context
+	RollbackContext(ctx context.Context, operation *Operation) error
+
+	// Rolls back a previously run Operation and runs it again. If the rollback fails the
+	// Operation is not re-run.
+	//
+	// Useful when iterating on an Operation during development.
+	Redo(operation *Operation) error
+
+	// Same as Redo but the requests to Elasticsearch are bound to the context
+	RedoContext(ctx context.Context, operation *Operation) error
+
+	// Restores the indices targeted by a previously run Operation from the snapshot taken
+	// before it ran. The record of the Operation is removed so that it is run again on the
+	// next call to Run.
 	//
-	// The filename passed in must also contain the file extension (*.json)
+	// An error is returned if no snapshot was taken.
+	Restore(id string) error
+
+	// Same as Restore but the requests to Elasticsearch are bound to the context
+	RestoreContext(ctx context.Context, id string) error
+
+	// Load an operation from the TargetDir into an Operation struct. No requests are made
+	// to Elasticsearch.
+	//
+	// Operations are written in JSON (*.json) or YAML (*.yml, *.yaml) with the same fields.
+	// If the file extension is left out of the filename, whichever file exists is loaded.
+	// Operations in subdirectories are loaded by their path relative to the TargetDir, or
+	// by their filename alone if it is unique.
 	Load(filename string) (*Operation, error)
 
+	// Loads every operation in the TargetDir and its subdirectories, in the order they run.
+	// No requests are made to Elasticsearch.
+	LoadAll() ([]*Operation, error)
+
+	// Marks every Operation in the TargetDir up to and including the given id as applied
+	// without running it. This is used to adopt esdt on a cluster whose resources were
+	// created by hand. Operations that have already been run are left untouched.
+	//
+	// The records written are flagged as baseline in the operations index. If any record
+	// could not be written, the others are still written and a BaselineErrors is returned.
+	Baseline(id string) error
+
+	// Same as Baseline but the requests to Elasticsearch are bound to the context
+	BaselineContext(ctx context.Context, id string) error
+
+	// Records the Operation with the given id as applied without running it. Used to
+	// reconcile the operations index after the cluster has been repaired by hand.
+	//
+	// If the Config is Protected, force must be true.
+	MarkApplied(id string, force bool) error
+
+	// Same as MarkApplied but the requests to Elasticsearch are bound to the context
+	MarkAppliedContext(ctx context.Context, id string, force bool) error
+
+	// Removes the record of the Operation with the given id without running its rollback,
+	// so that it is run again on the next call to Run.
+	//
+	// If the Config is Protected, force must be true.
+	MarkPending(id string, force bool) error
+
+	// Same as MarkPending but the requests to Elasticsearch are bound to the context
+	MarkPendingContext(ctx context.Context, id string, force bool) error
+
+	// Checks every operation file in the TargetDir without making any requests to
+	// Elasticsearch, returning the problems found. An error is returned if the TargetDir
+	// cannot be read.
+	Validate() ([]*ValidationIssue, error)
+
+	// Compares the live mapping of an index, alias or pattern with a new mapping, returning
+	// the changes for each index it resolves to. The new mapping is either an operation which
+	// updates a mapping, e.g. PUT users/_mapping, or a JSON or YAML file holding the whole
+	// mapping. Fields missing from an operation are not reported as removed, since
+	// Elasticsearch merges the update into the existing mapping.
+	DiffMapping(index string, filename string) (map[string][]*MappingChange, error)
+
+	// Same as DiffMapping but the requests to Elasticsearch are bound to the context
+	DiffMappingContext(ctx context.Context, index string, filename string) (map[string][]*MappingChange, error)
+
+	// Compares each operation which has not yet run and updates a mapping with the live
+	// mapping of its index, returning the breaking changes, such as type and analyzer
+	// changes, which Elasticsearch would reject.
+	ValidateMappings() ([]*ValidationIssue, error)
+
+	// Same as ValidateMappings but the requests to Elasticsearch are bound to the context
+	ValidateMappingsContext(ctx context.Context) ([]*ValidationIssue, error)
+
+	// Reads the component templates, index templates, legacy templates, ingest pipelines and
+	// indices matching the pattern from the cluster, returning the operations which would
+	// create them, each with the rollback which deletes it. Indices are created with their
+	// mappings, aliases and settings, without the settings Elasticsearch sets itself like
+	// index.uuid. Hidden indices and the resources Elasticsearch installs are skipped.
+	//
+	// The Id of each operation is its name, e.g. create_index_users, without a timestamp.
+	Export(indices string) ([]*Operation, error)
+
+	// Same as Export but the requests to Elasticsearch are bound to the context
+	ExportContext(ctx context.Context, indices string) ([]*Operation, error)
+
+	// Compares the indices, templates, ingest pipelines and ILM policies managed by esdt
+	// between the environment of this esdt and another environment in the ConfigFile,
+	// returning the differences in their mappings, settings, aliases and definitions. The
+	// managed resources are those targeted by the operations in the TargetDir and declared in
+	// the ResourcesDir. The other environment is configured by the ConfigFile alone.
+	Drift(against string) ([]*DriftItem, error)
+
+	// Same as Drift but the requests to Elasticsearch are bound to the context
+	DriftContext(ctx context.Context, against string) ([]*DriftItem, error)
+
+	// Compares the resources declared in the ResourcesDir with the cluster and returns the
+	// changes Apply would make, without making them.
+	//
+	// Index templates, component templates, ingest pipelines, ILM policies and aliases are
+	// declared in the component_templates, index_templates, pipelines, ilm_policies and aliases
+	// subdirectories, named by their filename. If prune is set, resources marked as managed by
+	// esdt which are no longer declared are deleted.
+	PlanResources(prune bool) ([]*ResourceChange, error)
+
+	// Same as PlanResources but the requests to Elasticsearch are bound to the context
+	PlanResourcesContext(ctx context.Context, prune bool) ([]*ResourceChange, error)
+
+	// Creates or updates the resources declared in the ResourcesDir which differ from the
+	// cluster, and deletes the resources pruned, returning the changes made. Resources which
+	// already match their declaration are left untouched. No operations index is used.
+	Apply(prune bool) ([]*ResourceChange, error)
+
+	// Same as Apply but the requests to Elasticsearch are bound to the context
+	ApplyContext(ctx context.Context, prune bool) ([]*ResourceChange, error)
+
 	// Get the passed in Config struct that is tied to this instance
 	// of esdt
 	GetConfig() *Config
@@ -53,6 +190,19 @@ type Esdt interface {
 
 type esdtImpl struct {
 	Config *Config
+
+	// Incremented by each request to balance requests across the hosts
+	next *uint32
+
+	// The context requests to Elasticsearch are bound to
+	ctx context.Context
+
+	// The client shared by all requests to Elasticsearch
+	client *req.Req
+
+	// The error raised loading the Config or building the client. It is returned by every
+	// request to Elasticsearch.
+	initErr error
 }
 
 // A singular piece of instruction to be run against the Elasticsearch cluster
@@ -68,12 +218,35 @@ type Operation struct {
 	// e.g. users/_search
 	Uri string `json:"uri"`
 
+	// The query string parameters added to the Uri e.g. refresh: true. Values may be strings,
+	// numbers or booleans. Not required.
+	Params map[string]interface{} `json:"params,omitempty"`
+
+	// The headers sent with the request, on top of the Headers in the Config. Not required.
+	Headers map[string]string `json:"headers,omitempty"`
+
 	// The body of the Elasticsearch request. Not required.
 	Body map[string]interface{} `json:"body"`
 
 	// The work that will be done if Rollback is called on this Operation
 	Rollback RollbackTemplate `json:"rollback"`
 
+	// The snapshot repository to snapshot the targeted indices into before the Operation
+	// runs. Not required. Overrides the SnapshotRepo in the Config.
+	Snapshot string `json:"snapshot,omitempty"`
+
+	// The indices snapshotted and restored, for an Operation whose indices cannot be told from
+	// its URI or body, e.g. POST _bulk. Not required.
+	SnapshotIndices []string `json:"snapshot_indices,omitempty"`
+
+	// Whether the Operation can safely be sent more than once. POST Operations are only
+	// retried if this is set.
+	RetrySafe bool `json:"retry_safe,omitempty"`
+
+	// The deadline for running the Operation e.g. 30s. Overrides the OperationTimeout in the
+	// Config. Not required.
+	Timeout string `json:"timeout,omitempty"`
+
 	// The Id for the Operation. This identifies whether or not the Operation
 	// has run previously. If two Operations have the same Id, only one can run.
 	Id string
@@ -81,20 +254,73 @@ type Operation struct {
 
 // Same as an Operation but is only run when Rollback is called on the operation
 type RollbackTemplate struct {
-	Method string                 `json:"method"`
-	Uri    string                 `json:"uri"`
-	Body   map[string]interface{} `json:"body"`
+	Method  string                 `json:"method"`
+	Uri     string                 `json:"uri"`
+	Params  map[string]interface{} `json:"params,omitempty"`
+	Headers map[string]string      `json:"headers,omitempty"`
+	Body    map[string]interface{} `json:"body"`
+
+	// When set to auto, the rollback is derived from the Operation when Rollback is called
+	// and Method, Uri and Body are ignored. Templates, pipelines and settings overwritten by
+	// the Operation are captured before it runs and restored on rollback.
+	Mode string `json:"mode,omitempty"`
 }
 
 // The configuration used for all calls on the esdt struct
 type Config struct {
 	// The Elasticsearch URL e.g. http://my-elasticsearch.com or http://localhost:9200
+	//
+	// A comma separated list of URLs may be given instead of Hosts
 	Conn string
 
+	// The Elasticsearch URLs to balance requests across. If a host cannot be reached the
+	// next one is tried. Takes precedence over Conn.
+	Hosts []string
+
+	// The number of times a request is attempted before giving up. Defaults to 3.
+	//
+	// Requests are retried on connection errors and 429, 502, 503 and 504 responses. POST
+	// requests are not idempotent, so they are only retried if they failed to connect or the
+	// Operation is marked RetrySafe.
+	MaxAttempts int `yaml:"max_attempts"`
+
+	// The backoff before the first retry once every host has been tried. It doubles with each
+	// retry up to RetryMaxBackoff and is jittered. Defaults to 100ms and 10s.
+	RetryBackoff    time.Duration `yaml:"retry_backoff"`
+	RetryMaxBackoff time.Duration `yaml:"retry_max_backoff"`
+
+	// The deadline for each call on the esdt, e.g. RunAll. Not required.
+	Timeout time.Duration
+
+	// The deadline for running each Operation, unless the Operation sets its own. Not required.
+	OperationTimeout time.Duration `yaml:"operation_timeout"`
+
+	// How long to wait for the Elasticsearch cluster to become reachable and healthy before
+	// the operations index is checked. Not waited for if empty.
+	WaitForCluster time.Duration `yaml:"wait_for_cluster"`
+
+	// The cluster health status to wait for, either red, yellow or green. Defaults to yellow.
+	WaitForStatus string `yaml:"wait_for_status"`
+
 	// The directory housing all of the files relevant to the esdt. By default,
 	// this is es/operations within your current directory
+	//
+	// Operations in subdirectories are included, with the subdirectory as part of their
+	// id. A comma separated list of directories may be given instead of TargetDirs.
 	TargetDir string
 
+	// The directories to load operations from, merged into one plan ordered by filename.
+	// Takes precedence over TargetDir.
+	TargetDirs []string `yaml:"target_dirs"`
+
+	// The directory declaring the resources applied by Apply, with a subdirectory for each
+	// kind of resource. By default, this is es/resources within your current directory
+	ResourcesDir string `yaml:"resources_dir"`
+
+	// The file system operations and the ConfigFile are read from, e.g. an embed.FS, in which
+	// case the TargetDir and ConfigFile are paths within it. Defaults to the disk.
+	FS fs.FS `yaml:"-"`
+
 	// The fullfile path location of your config file if it is not in the default es/config.yml
 	ConfigFile string
 
@@ -106,6 +332,82 @@ type Config struct {
 
 	// The password used for the Elasticsearch cluster
 	Password string
+
+	// A file containing the password, used if Password is empty
+	PasswordFile string `yaml:"password_file"`
+
+	// The Elasticsearch API key, either as the encoded key or as id:api_key. Takes precedence
+	// over BearerToken, Username and Password.
+	ApiKey string `yaml:"api_key"`
+
+	// A file containing the API key, used if ApiKey is empty
+	ApiKeyFile string `yaml:"api_key_file"`
+
+	// The bearer token for the Elasticsearch cluster. Takes precedence over Username and Password.
+	BearerToken string `yaml:"bearer_token"`
+
+	// A file containing the bearer token, used if BearerToken is empty
+	BearerTokenFile string `yaml:"bearer_token_file"`
+
+	// How requests are authenticated. Set to aws-sigv4 to sign requests for Amazon OpenSearch
+	// Service using the credentials in the standard AWS environment variables or shared
+	// credentials file. Otherwise ApiKey, BearerToken or Username and Password are used.
+	AuthMode string `yaml:"auth_mode"`
+
+	// The AWS region and service requests are signed for. The region defaults to AWS_REGION
+	// and the service defaults to es.
+	AwsRegion  string `yaml:"aws_region"`
+	AwsService string `yaml:"aws_service"`
+
+	// The profile used from the AWS shared credentials file. Defaults to AWS_PROFILE or default.
+	AwsProfile string `yaml:"aws_profile"`
+
+	// Whether this environment is protected. Commands which alter the operations records
+	// without running anything must be forced in a protected environment.
+	Protected bool
+
+	// Glob patterns of the files in the TargetDir which are not operations, e.g. *.bak. Hidden
+	// files, markdown files and the ConfigFile are always excluded.
+	Exclude []string
+
+	// Runs the valid operations when other files in the TargetDir could not be loaded,
+	// rather than running nothing. The files are reported either way.
+	SkipInvalid bool `yaml:"skip_invalid"`
+
+	// The snapshot repository to snapshot the targeted indices into before each Operation
+	// runs. Snapshots are skipped if empty.
+	SnapshotRepo string `yaml:"snapshot_repo"`
+
+	// The path to a PEM encoded CA bundle used to verify the Elasticsearch cluster's certificate.
+	// The system's CAs are used if empty.
+	CACert string `yaml:"ca_cert"`
+
+	// The paths to a PEM encoded client certificate and key, used for mutual TLS
+	ClientCert string `yaml:"client_cert"`
+	ClientKey  string `yaml:"client_key"`
+
+	// The server name used to verify the Elasticsearch cluster's certificate, if it differs
+	// from the host in Conn
+	ServerName string `yaml:"server_name"`
+
+	// Skips verification of the Elasticsearch cluster's certificate. Only use this for testing.
+	Insecure bool
+
+	// The client used for every request, e.g. one already instrumented for tracing. Its
+	// transport is used as is, so the TLS settings are ignored. Takes precedence over Transport.
+	HttpClient *http.Client `yaml:"-"`
+
+	// The transport used for every request in place of the one built from the TLS settings
+	Transport http.RoundTripper `yaml:"-"`
+
+	// Headers sent with every request, e.g. a tenant or routing header required by a gateway.
+	// The authentication headers take precedence.
+	Headers map[string]string
+
+	// The HTTP proxy requests are sent through e.g. http://proxy:3128. Hosts in the NO_PROXY
+	// environment variable bypass it. Defaults to the HTTP_PROXY and HTTPS_PROXY environment
+	// variables. Ignored if HttpClient or Transport is set.
+	Proxy string
 }
 
 func (e *esdtImpl) GetConfig() *Config {
@@ -113,37 +415,240 @@ func (e *esdtImpl) GetConfig() *Config {
 }
 
 func (e *esdtImpl) RunAll() error {
-	ex, err := e.operationsIndexExists()
+	return e.RunAllContext(context.Background())
+}
+
+func (e *esdtImpl) RunAllContext(ctx context.Context) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	operations, err := e.loadAll()
 	if err != nil {
 		return err
 	}
 
-	if !ex {
-		err = e.createOperationsIndex()
-		if err != nil {
-			return err
+	err = e.ensureOperationsIndex()
+	if err != nil {
+		return err
+	}
+
+	e.executeDataTemplates(operations)
+
+	return e.ctx.Err()
+}
+
+func (e *esdtImpl) Baseline(id string) error {
+	return e.BaselineContext(context.Background(), id)
+}
+
+func (e *esdtImpl) BaselineContext(ctx context.Context, id string) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	f, err := e.findOperationFile(id)
+	if err != nil {
+		return err
+	}
+
+	operations, err := e.loadAll()
+	if err != nil {
+		return err
+	}
+
+	// The file may have been left out of the plan, e.g. because it is excluded, invalid or
+	// a duplicate, in which case there is nothing to baseline up to
+	var baseline []*Operation
+	found := false
+	for _, v := range operations {
+		baseline = append(baseline, v)
+		if v.Id == f.Id() {
+			found = true
+			break
 		}
 	}
 
-	fi, err := ioutil.ReadDir(e.Config.TargetDir)
+	if !found {
+		return errors.New(fmt.Sprintf("Could not find operation %s", id))
+	}
+
+	err = e.ensureOperationsIndex()
 	if err != nil {
-		return errors.New(fmt.Sprintf("Could not find directory %s", e.Config.TargetDir))
+		return err
+	}
+
+	errs := e.baselineDataTemplates(baseline)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func (e *esdtImpl) MarkApplied(id string, force bool) error {
+	return e.MarkAppliedContext(context.Background(), id, force)
+}
+
+func (e *esdtImpl) MarkAppliedContext(ctx context.Context, id string, force bool) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	if e.Config.Protected && !force {
+		return errors.New(ProtectedEnvErrorMsg)
+	}
+
+	operation, err := e.Load(id)
+	if err != nil {
+		return err
+	}
+
+	err = e.ensureOperationsIndex()
+	if err != nil {
+		return err
+	}
+
+	if e.operationsDocumentExists(operation.Id) {
+		return errors.New("Already ran")
+	}
+
+	return e.insertOperationRecord(operation.Id, &operations{
+		InsertedAt: time.Now(),
+		Manual:     true,
+	})
+}
+
+func (e *esdtImpl) MarkPending(id string, force bool) error {
+	return e.MarkPendingContext(context.Background(), id, force)
+}
+
+func (e *esdtImpl) MarkPendingContext(ctx context.Context, id string, force bool) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	if e.Config.Protected && !force {
+		return errors.New(ProtectedEnvErrorMsg)
+	}
+
+	id = e.resolveId(id)
+	if !e.operationsDocumentExists(id) {
+		return errors.New(fmt.Sprintf("%s has not been run", id))
+	}
+
+	return e.deleteOperationIndex(id)
+}
+
+func (e *esdtImpl) Restore(id string) error {
+	return e.RestoreContext(context.Background(), id)
+}
+
+func (e *esdtImpl) RestoreContext(ctx context.Context, id string) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	return e.restoreSnapshot(e.resolveId(id))
+}
+
+// Returns a copy of the esdt whose requests are bound to the context
+func (e *esdtImpl) withContext(ctx context.Context) *esdtImpl {
+	c := *e
+	c.ctx = ctx
+	return &c
+}
+
+// Binds the esdt to the context for a call, applying the Timeout in the Config
+func (e *esdtImpl) begin(ctx context.Context) (*esdtImpl, context.CancelFunc) {
+	cancel := func() {}
+	if e.Config != nil && e.Config.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, e.Config.Timeout)
+	}
+	return e.withContext(ctx), cancel
+}
+
+func (e *esdtImpl) LoadAll() ([]*Operation, error) {
+	return e.loadAll()
+}
+
+// Loads every operation found in the target directories, in the order they run. Files
+// matching the Exclude patterns and the config file are skipped. Every other file must be
+// a valid operation with a unique id, otherwise the problems with each file are returned
+// together, unless SkipInvalid is set in which case they are only reported.
+func (e *esdtImpl) loadAll() ([]*Operation, error) {
+	files, others, err := e.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*Operation)
+	loadErrs := make(map[string]error)
+	included := make(map[string]bool)
+	for _, v := range files {
+		operation, includes, err := e.loadFile(v)
+		for _, p := range includes {
+			included[p] = true
+		}
+		if err != nil {
+			loadErrs[v.FullPath()] = err
+			continue
+		}
+		loaded[v.FullPath()] = operation
+	}
+
+	// Files included by operations are not operations themselves
+	files = withoutIncluded(files, included)
+	others = withoutIncluded(others, included)
+
+	var errs LoadErrors
+	for _, v := range others {
+		errs = append(errs, errors.New(fmt.Sprintf("invalid elasticsearch operation %s, expected a .json, .yml or .yaml file", v.FullPath())))
+	}
+
+	duplicates, ids := duplicateIds(files)
+	for _, v := range ids {
+		errs = append(errs, errors.New(fmt.Sprintf("Duplicate operation id %s in %s", v, joinPaths(duplicates[v]))))
 	}
 
 	var operations []*Operation
-	for _, v := range fi {
-		operation, err := e.Load(v.Name())
-		if err == nil {
-			operations = append(operations, operation)
+	for _, v := range files {
+		if _, ok := duplicates[v.Id()]; ok {
+			continue
 		}
+		if err, ok := loadErrs[v.FullPath()]; ok {
+			errs = append(errs, err)
+			continue
+		}
+		operations = append(operations, loaded[v.FullPath()])
 	}
 
-	e.executeDataTemplates(operations)
+	if len(errs) > 0 {
+		if !e.Config.SkipInvalid {
+			return nil, errs
+		}
+		for _, v := range errs {
+			color.Yellow("Skipping %s", v.Error())
+		}
+	}
 
-	return nil
+	return operations, nil
+}
+
+// The problems found with the operation files when loading every operation
+type LoadErrors []error
+
+func (l LoadErrors) Error() string {
+	messages := make([]string, len(l))
+	for i, v := range l {
+		messages[i] = v.Error()
+	}
+	return fmt.Sprintf("%d operation files could not be loaded:\n%s", len(l), strings.Join(messages, "\n"))
 }
 
 func (e *esdtImpl) RollbackFile(filename string) error {
+	return e.RollbackFileContext(context.Background(), filename)
+}
+
+func (e *esdtImpl) RollbackFileContext(ctx context.Context, filename string) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
 	dt, err := e.Load(filename)
 	if err != nil {
 		return err
@@ -152,35 +657,89 @@ func (e *esdtImpl) RollbackFile(filename string) error {
 }
 
 func (e *esdtImpl) Load(filename string) (*Operation, error) {
-	if !JsonRegEx.MatchString(filename) {
-		return nil, errors.New(fmt.Sprintf("invalid elasticsearch operation %s", filename))
+	f, err := e.findOperationFile(filename)
+	if err != nil {
+		return nil, err
 	}
-	fp := filepath.Join(e.Config.TargetDir, filename)
-	out, err := ioutil.ReadFile(fp)
+	operation, _, err := e.loadFile(f)
+	return operation, err
+}
+
+// Loads an operation file, resolving the files it includes. The paths of the included files
+// are returned.
+func (e *esdtImpl) loadFile(f operationFile) (*Operation, []string, error) {
+	fp := f.FullPath()
+	out, err := fs.ReadFile(e.Config.files(), fp)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Problems reading file %s", fp))
+		return nil, nil, errors.New(fmt.Sprintf("Problems reading file %s", fp))
 	}
 	var dataTemplate Operation
-	err = json.Unmarshal(out, &dataTemplate)
+	err = decodeOperation(f.Path, out, &dataTemplate, false)
 	if err != nil {
-		return nil, errors.New(fmt.Sprintf("Could not parse file %s, double check your json", fp))
+		return nil, nil, errors.New(fmt.Sprintf("Could not parse file %s, double check your %s: %s", fp, operationFormat(f.Path), describeDecodeError(f.Path, out, err)))
 	}
-	dataTemplate.Id = strings.TrimSuffix(filename, filepath.Ext(filename))
-	return &dataTemplate, nil
+	includes, err := e.resolveIncludes(f, &dataTemplate)
+	if err != nil {
+		return nil, includes, errors.Wrap(err, fmt.Sprintf("Could not load file %s", fp))
+	}
+	dataTemplate.Id = f.Id()
+	return &dataTemplate, includes, nil
 }
 
 // Attempts to rollback any previously run Operation. If the operation
 // has not yet been run, an error is returned
 func (e *esdtImpl) Rollback(operation *Operation) error {
+	return e.RollbackContext(context.Background(), operation)
+}
+
+func (e *esdtImpl) RollbackContext(ctx context.Context, operation *Operation) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
 	return e.rollbackDataTemplate(operation)
 }
 
+// Rolls back a previously run Operation and runs it again. If the rollback fails the
+// Operation is not re-run, and if the Operation has not run neither is sent.
+func (e *esdtImpl) Redo(operation *Operation) error {
+	return e.RedoContext(context.Background(), operation)
+}
+
+func (e *esdtImpl) RedoContext(ctx context.Context, operation *Operation) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	// The rollback of an operation which never ran would undo changes made by something else
+	if !e.operationsDocumentExists(operation.Id) {
+		return errors.New(fmt.Sprintf("%s has not been run", operation.Id))
+	}
+
+	err := e.rollbackDataTemplate(operation)
+	if err != nil {
+		return errors.Wrap(err, RedoRollbackFailedMsg)
+	}
+
+	err = e.RunContext(e.ctx, operation)
+	if err != nil {
+		return errors.Wrap(err, RedoRunFailedMsg)
+	}
+
+	return nil
+}
+
 // Runs a specified Operation.
 //
 // If the operations index has not yet been created on the Elasticsearch, it is created here.
 // This command also attempts to perform a rollback if an error occurs. There is no need to
 // call Rollback(Operation) if an error is returned.
 func (e *esdtImpl) Run(operation *Operation) error {
+	return e.RunContext(context.Background(), operation)
+}
+
+func (e *esdtImpl) RunContext(ctx context.Context, operation *Operation) error {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
 	operation.Id = strings.TrimSpace(operation.Id)
 	if operation.Body == nil {
 		operation.Body = make(map[string]interface{})
@@ -188,22 +747,11 @@ func (e *esdtImpl) Run(operation *Operation) error {
 	if operation.Rollback.Body == nil {
 		operation.Rollback.Body = make(map[string]interface{})
 	}
-	ex, err := e.operationsIndexExists()
+	err := e.ensureOperationsIndex()
 	if err != nil {
 		return err
 	}
 
-	if !ex {
-		err = e.createOperationsIndex()
-		if err != nil {
-			return err
-		}
-	}
-
-	if err != nil {
-		return errors.New(fmt.Sprintf("Could not find directory %s", e.Config.TargetDir))
-	}
-
 	return e.executeDataTemplate(operation)
 }
 
@@ -214,14 +762,20 @@ func (e *esdtImpl) Run(operation *Operation) error {
 // The config used on esdt will take precedence over an config found in the config.yml in
 // the operations directory
 func New(config *Config) Esdt {
-	return &esdtImpl{
-		Config: loadConfig(config),
+	e := &esdtImpl{
+		next: new(uint32),
+		ctx:  context.Background(),
 	}
+	e.Config, e.initErr = loadConfig(config)
+	if e.initErr == nil {
+		e.client, e.initErr = newClient(e.Config)
+	}
+	return e
 }
 
 type yamlConfig map[string]*Config
 
-func loadConfig(in *Config) (c *Config) {
+func loadConfig(in *Config) (c *Config, err error) {
 	if in == nil {
 		in = &Config{}
 	}
@@ -230,24 +784,34 @@ func loadConfig(in *Config) (c *Config) {
 		in.ConfigFile = DefaultConfigFile
 	}
 
-	content, err := ioutil.ReadFile(in.ConfigFile)
+	content, err := fs.ReadFile(in.files(), in.fsPath(in.ConfigFile))
 	if err == nil {
 		var yc yamlConfig
 		err = yaml.Unmarshal(content, &yc)
 		if err != nil {
-			return nil
+			return defaultConfig(in), errors.New(fmt.Sprintf("Could not parse config file %s", in.ConfigFile))
 		}
 
 		c = yc[in.Env]
 		if c == nil {
 			c = in
+		} else {
+			err = resolveSecretRefs(c)
+			if err != nil {
+				return defaultConfig(in), err
+			}
 		}
 	}
 	c = defaultConfig(c)
 
 	mergo.Merge(c, *in, mergo.WithOverride)
 
-	return c
+	err = resolveSecretFiles(c)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
 }
 
 func defaultConfig(c *Config) *Config {
@@ -257,8 +821,20 @@ func defaultConfig(c *Config) *Config {
 	if c.TargetDir == "" {
 		c.TargetDir = DefaultTargetDir
 	}
+	if c.ResourcesDir == "" {
+		c.ResourcesDir = DefaultResourcesDir
+	}
 	if c.Conn == "" {
 		c.Conn = DefaultConnUrl
 	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultMaxAttempts
+	}
+	if c.RetryBackoff == 0 {
+		c.RetryBackoff = DefaultRetryBackoff
+	}
+	if c.RetryMaxBackoff == 0 {
+		c.RetryMaxBackoff = DefaultRetryMaxBackoff
+	}
 	return c
 }
@@ -0,0 +1,164 @@
+package esdt
+
+import (
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// The settings Elasticsearch sets itself when an index is created, which are rejected when
+// creating an index. Entries ending in a dot are prefixes.
+var readOnlySettings = []string{
+	"index.uuid",
+	"index.creation_date",
+	"index.provided_name",
+	"index.version.",
+	"index.history.uuid",
+	"index.resize.",
+	"index.routing.allocation.initial_recovery.",
+	"index.verified_before_close",
+}
+
+// The resources exported before indices, in the order they are created so that the indices
+// created after them pick them up
+var exportedKinds = []resourceKind{
+	{Dir: "component_templates", Api: "_component_template"},
+	{Dir: "legacy_templates", Api: "_template"},
+	{Dir: "index_templates", Api: "_index_template"},
+	{Dir: "pipelines", Api: "_ingest/pipeline"},
+}
+
+var unsafeNameRegEx = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+func (e *esdtImpl) Export(indices string) ([]*Operation, error) {
+	return e.ExportContext(context.Background(), indices)
+}
+
+func (e *esdtImpl) ExportContext(ctx context.Context, indices string) ([]*Operation, error) {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	var operations []*Operation
+	for _, kind := range exportedKinds {
+		resources, err := e.currentResources(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range sortedNames(resources) {
+			if builtInResource(name, resources[name]) {
+				continue
+			}
+			operations = append(operations, exportOperation(
+				fmt.Sprintf("create_%s_%s", strings.TrimSuffix(kind.Dir, "s"), name),
+				kind.Api+"/"+url.PathEscape(name),
+				resources[name],
+			))
+		}
+	}
+
+	state, err := e.exportIndices(indices)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range sortedKeys(state) {
+		// Hidden indices and the operations index are not created by operations
+		if strings.HasPrefix(name, ".") || name == OperationsIndex {
+			continue
+		}
+		index, _ := state[name].(map[string]interface{})
+		operations = append(operations, exportOperation("create_index_"+name, url.PathEscape(name), indexBody(index)))
+	}
+
+	return operations, nil
+}
+
+// Fetches the aliases, mappings and flattened settings of the indices matching the pattern.
+// Indices which do not exist are left out.
+func (e *esdtImpl) exportIndices(indices string) (map[string]interface{}, error) {
+	if indices == "" {
+		indices = "*"
+	}
+
+	res, err := e.runEsQuery(url.PathEscape(indices)+"?flat_settings=true&ignore_unavailable=true", "get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("did not receive a response from elasticsearch")
+	}
+
+	if res.Response().StatusCode == http.StatusNotFound {
+		return map[string]interface{}{}, nil
+	}
+	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
+		return nil, errors.New(fmt.Sprintf("Could not fetch the indices %s: %s", indices, res.Response().Status))
+	}
+
+	var state map[string]interface{}
+	err = res.ToJSON(&state)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse the indices %s", indices))
+	}
+	return state, nil
+}
+
+// The body which creates an index as it is, without the settings Elasticsearch sets itself
+func indexBody(index map[string]interface{}) map[string]interface{} {
+	body := make(map[string]interface{})
+
+	if settings, ok := index["settings"].(map[string]interface{}); ok {
+		kept := make(map[string]interface{})
+		for k, v := range settings {
+			if !readOnlySetting(k) {
+				kept[k] = v
+			}
+		}
+		if len(kept) > 0 {
+			body["settings"] = kept
+		}
+	}
+
+	for _, k := range []string{"mappings", "aliases"} {
+		if v, ok := index[k].(map[string]interface{}); ok && len(v) > 0 {
+			body[k] = v
+		}
+	}
+
+	return body
+}
+
+func readOnlySetting(key string) bool {
+	for _, v := range readOnlySettings {
+		if key == v || (strings.HasSuffix(v, ".") && strings.HasPrefix(key, v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a resource was installed by Elasticsearch itself, rather than created on the cluster
+func builtInResource(name string, body map[string]interface{}) bool {
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	meta, _ := body["_meta"].(map[string]interface{})
+	managed, _ := meta["managed"].(bool)
+	return managed
+}
+
+// An operation which PUTs a resource, with the rollback which deletes it
+func exportOperation(name string, uri string, body map[string]interface{}) *Operation {
+	operation := &Operation{
+		Method: "PUT",
+		Uri:    uri,
+		Body:   body,
+		Id:     unsafeNameRegEx.ReplaceAllString(strings.ToLower(name), "_"),
+	}
+	operation.Rollback, _ = DeriveRollback(operation)
+	return operation
+}
@@ -0,0 +1,61 @@
+package esdt
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Reads files from disk. Unlike os.DirFS, names may be absolute or relative to the working
+// directory, so that the TargetDir and ConfigFile are read as they always have been.
+type diskFS struct{}
+
+func (diskFS) Open(name string) (fs.File, error) {
+	return os.Open(filepath.FromSlash(name))
+}
+
+func (diskFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(filepath.FromSlash(name))
+}
+
+func (diskFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(filepath.FromSlash(name))
+}
+
+func (diskFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(filepath.FromSlash(name))
+}
+
+// The file system operations and the config file are read from
+func (c *Config) files() fs.FS {
+	if c.FS != nil {
+		return c.FS
+	}
+	return diskFS{}
+}
+
+// Converts a path from the Config to the form used by its file system
+func (c *Config) fsPath(p string) string {
+	if c.FS != nil {
+		return path.Clean(p)
+	}
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// Whether the file at the path within the file system is the ConfigFile
+func (c *Config) isConfigFile(p string) bool {
+	if c.FS != nil {
+		return path.Clean(p) == path.Clean(c.ConfigFile)
+	}
+
+	a, err := os.Stat(filepath.FromSlash(p))
+	if err != nil {
+		return false
+	}
+	b, err := os.Stat(c.ConfigFile)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(a, b)
+}
@@ -0,0 +1,94 @@
+package esdt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// The interval between polls of the cluster health while waiting for the cluster
+const waitForClusterInterval = time.Second
+
+var clusterStatusRank = map[string]int{
+	"red":    0,
+	"yellow": 1,
+	"green":  2,
+}
+
+type clusterHealthRes struct {
+	Status string `json:"status"`
+}
+
+// Polls the cluster health until the cluster is reachable and at least WaitForStatus, giving
+// up after WaitForCluster. Does nothing if WaitForCluster is not set.
+func (e *esdtImpl) waitForCluster() error {
+	if e.Config.WaitForCluster <= 0 {
+		return nil
+	}
+	if e.initErr != nil {
+		return e.initErr
+	}
+
+	status := e.Config.WaitForStatus
+	if status == "" {
+		status = DefaultWaitForStatus
+	}
+	if _, ok := clusterStatusRank[status]; !ok {
+		return errors.New(fmt.Sprintf("Invalid cluster status %s, expected red, yellow or green", status))
+	}
+
+	hosts := e.Config.hosts()
+	if len(hosts) == 0 {
+		return errors.New("Invalid connection URL")
+	}
+
+	ctx, cancel := context.WithTimeout(e.ctx, e.Config.WaitForCluster)
+	defer cancel()
+	w := e.withContext(ctx)
+
+	start := time.Now()
+	for attempt := 0; ; attempt++ {
+		reason := w.checkClusterHealth(hosts[attempt%len(hosts)], status)
+		if reason == "" {
+			color.Green("Elasticsearch is ready")
+			return nil
+		}
+
+		color.Yellow("Waiting for Elasticsearch (%s elapsed): %s", time.Since(start).Round(time.Second), reason)
+
+		select {
+		case <-ctx.Done():
+			if e.ctx.Err() != nil {
+				return e.ctx.Err()
+			}
+			return errors.New(fmt.Sprintf("Elasticsearch was not ready after %s: %s", e.Config.WaitForCluster, reason))
+		case <-time.After(waitForClusterInterval):
+		}
+	}
+}
+
+// Returns why the cluster is not ready, or an empty string if it is at least the given status
+func (e *esdtImpl) checkClusterHealth(host string, status string) string {
+	res, err := e.sendEsQuery(host, "_cluster/health", "get", nil, nil)
+	if err != nil {
+		return e.Config.redact(err.Error())
+	}
+	defer res.Response().Body.Close()
+
+	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
+		return fmt.Sprintf("%s responded with %s", host, res.Response().Status)
+	}
+
+	var h clusterHealthRes
+	json.NewDecoder(res.Response().Body).Decode(&h)
+
+	rank, ok := clusterStatusRank[h.Status]
+	if !ok || rank < clusterStatusRank[status] {
+		return fmt.Sprintf("cluster status is %s, waiting for %s", h.Status, status)
+	}
+
+	return ""
+}
@@ -0,0 +1,153 @@
+package esdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// An object whose only field is $include is replaced by the parsed contents of the JSON or
+// YAML file it names, e.g. { "$include": "mappings/user.json" }
+const IncludeDirective = "$include"
+
+// An object whose only field is $file is replaced by the contents of the file it names as a
+// string, e.g. { "source": { "$file": "scripts/migrate.painless" } }
+const FileDirective = "$file"
+
+// Resolves the include directives in the body and rollback body of an operation. The paths
+// are relative to the target directory the operation was found in. The paths of the included
+// files within the file system are returned.
+func (e *esdtImpl) resolveIncludes(f operationFile, operation *Operation) ([]string, error) {
+	r := &includeResolver{
+		fsys:  e.Config.files(),
+		dir:   f.Dir,
+		stack: []string{f.Path},
+	}
+
+	var err error
+	operation.Body, err = r.resolveBody(operation.Body)
+	if err != nil {
+		return r.included, err
+	}
+
+	operation.Rollback.Body, err = r.resolveBody(operation.Rollback.Body)
+	if err != nil {
+		return r.included, err
+	}
+
+	return r.included, nil
+}
+
+type includeResolver struct {
+	fsys fs.FS
+	dir  string
+
+	// The files being included, innermost last, to detect cycles
+	stack []string
+
+	included []string
+}
+
+func (r *includeResolver) resolveBody(body map[string]interface{}) (map[string]interface{}, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	resolved, err := r.resolve(body)
+	if err != nil {
+		return nil, err
+	}
+
+	m, ok := resolved.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("The included body must be an object")
+	}
+	return m, nil
+}
+
+func (r *includeResolver) resolve(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 1 {
+			if p, ok := t[IncludeDirective].(string); ok {
+				return r.include(p)
+			}
+			if p, ok := t[FileDirective].(string); ok {
+				content, _, err := r.read(p)
+				return string(content), err
+			}
+		}
+		for k, v := range t {
+			resolved, err := r.resolve(v)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = resolved
+		}
+		return t, nil
+	case []interface{}:
+		for i, v := range t {
+			resolved, err := r.resolve(v)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = resolved
+		}
+		return t, nil
+	}
+	return v, nil
+}
+
+func (r *includeResolver) include(p string) (interface{}, error) {
+	content, name, err := r.read(p)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, v := range r.stack {
+		if v == name {
+			cycle := append(append([]string(nil), r.stack[i:]...), name)
+			return nil, errors.New(fmt.Sprintf("Include cycle %s", strings.Join(cycle, " -> ")))
+		}
+	}
+
+	if YamlRegEx.MatchString(name) {
+		content, err = yamlToJson(content)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Could not parse included file %s: %s", name, err.Error()))
+		}
+	}
+
+	var v interface{}
+	err = json.Unmarshal(content, &v)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse included file %s: %s", name, describeDecodeError(name, content, err)))
+	}
+
+	r.stack = append(r.stack, name)
+	defer func() {
+		r.stack = r.stack[:len(r.stack)-1]
+	}()
+
+	return r.resolve(v)
+}
+
+// Reads an included file, returning its contents and its path relative to the target directory
+func (r *includeResolver) read(p string) ([]byte, string, error) {
+	name := path.Clean(strings.TrimPrefix(p, "/"))
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return nil, name, errors.New(fmt.Sprintf("Included file %s is outside of %s", p, r.dir))
+	}
+	fp := path.Join(r.dir, name)
+
+	content, err := fs.ReadFile(r.fsys, fp)
+	if err != nil {
+		return nil, name, errors.New(fmt.Sprintf("Could not read included file %s", fp))
+	}
+
+	r.included = append(r.included, fp)
+	return content, name, nil
+}
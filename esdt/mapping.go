@@ -0,0 +1,356 @@
+package esdt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// The kinds of change to a field in a mapping
+const (
+	MappingFieldAdded   = "added"
+	MappingFieldRemoved = "removed"
+	MappingFieldChanged = "changed"
+)
+
+// The mapping parameters of a field which cannot be changed once the field exists.
+// Elasticsearch rejects a mapping update that changes them, so the index must be reindexed.
+var fixedMappingParams = map[string]bool{
+	"type":           true,
+	"analyzer":       true,
+	"normalizer":     true,
+	"index":          true,
+	"doc_values":     true,
+	"store":          true,
+	"format":         true,
+	"similarity":     true,
+	"term_vector":    true,
+	"null_value":     true,
+	"index_prefixes": true,
+}
+
+// A difference between the mapping of a field in the cluster and a new mapping. Breaking
+// changes are rejected by Elasticsearch or silently ignored, so require a reindex.
+type MappingChange struct {
+	// The path of the field, with multi-fields and object properties separated by dots
+	Field string
+
+	// Either added, removed or changed
+	Kind string
+
+	Breaking bool
+
+	Message string
+}
+
+func (m *MappingChange) String() string {
+	return fmt.Sprintf("%s: %s", m.Field, m.Message)
+}
+
+// Compares the mapping of an index with a new mapping. Both are the mappings object, i.e.
+// the one holding properties. The changes are sorted by field.
+func DiffMappings(current map[string]interface{}, proposed map[string]interface{}) []*MappingChange {
+	var changes []*MappingChange
+	diffProperties("", properties(current, "properties"), properties(proposed, "properties"), &changes)
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+func diffProperties(prefix string, current map[string]interface{}, proposed map[string]interface{}, changes *[]*MappingChange) {
+	for _, name := range unionKeys(current, proposed) {
+		field := name
+		if prefix != "" {
+			field = prefix + "." + name
+		}
+
+		c, inCurrent := current[name].(map[string]interface{})
+		p, inProposed := proposed[name].(map[string]interface{})
+		switch {
+		case !inProposed:
+			*changes = append(*changes, &MappingChange{
+				Field:    field,
+				Kind:     MappingFieldRemoved,
+				Breaking: true,
+				Message:  "Removed from the mapping. Elasticsearch keeps existing fields, so removing it requires a reindex",
+			})
+		case !inCurrent:
+			*changes = append(*changes, &MappingChange{
+				Field:   field,
+				Kind:    MappingFieldAdded,
+				Message: fmt.Sprintf("Added as %s", fieldType(p)),
+			})
+		default:
+			diffField(field, c, p, changes)
+		}
+	}
+}
+
+func diffField(field string, current map[string]interface{}, proposed map[string]interface{}, changes *[]*MappingChange) {
+	if fieldType(current) != fieldType(proposed) {
+		*changes = append(*changes, &MappingChange{
+			Field:    field,
+			Kind:     MappingFieldChanged,
+			Breaking: true,
+			Message:  fmt.Sprintf("Type changed from %s to %s, which requires a reindex", fieldType(current), fieldType(proposed)),
+		})
+		return
+	}
+
+	for _, k := range unionKeys(current, proposed) {
+		if k == "type" || k == "properties" || k == "fields" {
+			continue
+		}
+		from, to := mappingValue(current[k]), mappingValue(proposed[k])
+		if from == to {
+			continue
+		}
+
+		message := fmt.Sprintf("%s changed from %s to %s", k, from, to)
+		if fixedMappingParams[k] {
+			message += ", which requires a reindex"
+		}
+		*changes = append(*changes, &MappingChange{
+			Field:    field,
+			Kind:     MappingFieldChanged,
+			Breaking: fixedMappingParams[k],
+			Message:  message,
+		})
+	}
+
+	diffProperties(field, properties(current, "properties"), properties(proposed, "properties"), changes)
+	diffProperties(field, properties(current, "fields"), properties(proposed, "fields"), changes)
+}
+
+// The type of a field. Fields with properties but no type are objects.
+func fieldType(field map[string]interface{}) string {
+	if t, ok := field["type"].(string); ok {
+		return t
+	}
+	return "object"
+}
+
+func properties(m map[string]interface{}, key string) map[string]interface{} {
+	p, _ := m[key].(map[string]interface{})
+	return p
+}
+
+// A mapping parameter as a string for comparison. Missing parameters are shown as the default.
+func mappingValue(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "the default"
+	case map[string]interface{}, []interface{}:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+func unionKeys(a map[string]interface{}, b map[string]interface{}) []string {
+	keys := sortedKeys(a)
+	for _, k := range sortedKeys(b) {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Unwraps the mappings of an index, or of the single type of an index created before
+// Elasticsearch 7, to the object holding properties
+func unwrapMapping(m map[string]interface{}) map[string]interface{} {
+	if mappings, ok := m["mappings"].(map[string]interface{}); ok {
+		m = mappings
+	}
+	if _, ok := m["properties"]; !ok && len(m) == 1 {
+		for _, v := range m {
+			if typed, ok := v.(map[string]interface{}); ok {
+				if _, ok := typed["properties"]; ok {
+					return typed
+				}
+			}
+		}
+	}
+	return m
+}
+
+// The index and new mapping of an Operation which updates a mapping, e.g. PUT users/_mapping.
+// The last return value is false if the Operation does not update a mapping.
+func operationMapping(operation *Operation) (string, map[string]interface{}, bool) {
+	method := strings.ToUpper(operation.Method)
+	if method != "PUT" && method != "POST" {
+		return "", nil, false
+	}
+
+	segments := strings.Split(uriPath(operation.Uri), "/")
+	if len(segments) < 2 || strings.HasPrefix(segments[0], "_") || (segments[1] != "_mapping" && segments[1] != "_mappings") {
+		return "", nil, false
+	}
+
+	return segments[0], unwrapMapping(operation.Body), true
+}
+
+func (e *esdtImpl) DiffMapping(index string, filename string) (map[string][]*MappingChange, error) {
+	return e.DiffMappingContext(context.Background(), index, filename)
+}
+
+func (e *esdtImpl) DiffMappingContext(ctx context.Context, index string, filename string) (map[string][]*MappingChange, error) {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	proposed, merged, err := e.loadMapping(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := e.liveMappings(index)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, errors.New(fmt.Sprintf("Index %s does not exist", index))
+	}
+
+	diffs := make(map[string][]*MappingChange)
+	for k, v := range current {
+		diffs[k] = DiffMappings(v, proposed)
+		if merged {
+			diffs[k] = withoutRemovals(diffs[k])
+		}
+	}
+	return diffs, nil
+}
+
+// Drops the fields missing from a mapping update, which Elasticsearch leaves as they are when
+// it merges the update into the existing mapping
+func withoutRemovals(changes []*MappingChange) []*MappingChange {
+	var kept []*MappingChange
+	for _, v := range changes {
+		if v.Kind != MappingFieldRemoved {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// Loads a new mapping from an operation, or from a JSON or YAML file holding the whole
+// mapping. The mapping of an operation is merged into the existing mapping, so the last return
+// value is true if it is from an operation.
+func (e *esdtImpl) loadMapping(filename string) (map[string]interface{}, bool, error) {
+	// A broken operation is reported rather than read as a mapping file
+	f, findErr := e.findOperationFile(filename)
+	if findErr == nil {
+		operation, _, err := e.loadFile(f)
+		if err != nil {
+			return nil, false, err
+		}
+		_, mapping, ok := operationMapping(operation)
+		if !ok {
+			return nil, false, errors.New(fmt.Sprintf("Operation %s does not update a mapping", operation.Id))
+		}
+		return mapping, true, nil
+	}
+
+	content, err := fs.ReadFile(e.Config.files(), e.Config.fsPath(filename))
+	if err != nil {
+		return nil, false, errors.Wrap(findErr, fmt.Sprintf("Could not find a mapping or operation %s", filename))
+	}
+
+	if YamlRegEx.MatchString(filename) {
+		content, err = yamlToJson(content)
+		if err != nil {
+			return nil, false, errors.New(fmt.Sprintf("Could not parse file %s, double check your YAML: %s", filename, err.Error()))
+		}
+	}
+
+	var mapping map[string]interface{}
+	err = json.Unmarshal(content, &mapping)
+	if err != nil {
+		return nil, false, errors.New(fmt.Sprintf("Could not parse file %s, double check your JSON: %s", filename, describeDecodeError(filename, content, err)))
+	}
+
+	return unwrapMapping(mapping), false, nil
+}
+
+// Fetches the mappings of the indices an index name, alias or pattern resolves to, keyed by
+// index. Nil is returned if the index does not exist.
+func (e *esdtImpl) liveMappings(index string) (map[string]map[string]interface{}, error) {
+	res, err := e.runEsQuery(url.PathEscape(index)+"/_mapping", "get", nil)
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, errors.New("did not receive a response from elasticsearch")
+	}
+
+	if res.Response().StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
+		return nil, errors.New(fmt.Sprintf("Could not fetch the mapping of %s: %s", index, res.Response().Status))
+	}
+
+	var state map[string]interface{}
+	err = res.ToJSON(&state)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse the mapping of %s", index))
+	}
+
+	mappings := make(map[string]map[string]interface{})
+	for k, v := range state {
+		m, _ := v.(map[string]interface{})
+		mappings[k] = unwrapMapping(m)
+	}
+	return mappings, nil
+}
+
+func (e *esdtImpl) ValidateMappings() ([]*ValidationIssue, error) {
+	return e.ValidateMappingsContext(context.Background())
+}
+
+func (e *esdtImpl) ValidateMappingsContext(ctx context.Context) ([]*ValidationIssue, error) {
+	e, cancel := e.begin(ctx)
+	defer cancel()
+
+	operations, err := e.loadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []*ValidationIssue
+	for _, v := range operations {
+		index, mapping, ok := operationMapping(v)
+		if !ok || e.operationsDocumentExists(v.Id) {
+			continue
+		}
+
+		current, err := e.liveMappings(index)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range sortedNames(current) {
+			for _, change := range withoutRemovals(DiffMappings(current[name], mapping)) {
+				if !change.Breaking {
+					continue
+				}
+				issues = append(issues, &ValidationIssue{
+					File:    v.Id,
+					Message: fmt.Sprintf("Breaking change to the mapping of %s, %s", name, change.String()),
+				})
+			}
+		}
+	}
+
+	return issues, nil
+}
@@ -0,0 +1,88 @@
+package esdt
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// The proxy used by the transport. The Proxy in the Config takes precedence over the
+// HTTP_PROXY and HTTPS_PROXY environment variables, and NO_PROXY is respected either way.
+func proxyFunc(c *Config) (func(*http.Request) (*url.URL, error), error) {
+	if c.Proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+
+	proxy := c.Proxy
+	if !strings.Contains(proxy, "://") {
+		proxy = "http://" + proxy
+	}
+	proxyUrl, err := url.Parse(proxy)
+	if err != nil || proxyUrl.Host == "" {
+		return nil, errors.New(fmt.Sprintf("Invalid proxy URL %s", c.redact(c.Proxy)))
+	}
+
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+
+	return func(r *http.Request) (*url.URL, error) {
+		if bypassProxy(noProxy, r.URL) {
+			return nil, nil
+		}
+		return proxyUrl, nil
+	}, nil
+}
+
+// Whether the URL matches an entry in the comma separated NO_PROXY list. Entries are
+// hosts, which also match their subdomains, IPs or CIDR ranges, optionally with a port.
+// An entry of * matches every URL.
+func bypassProxy(noProxy string, u *url.URL) bool {
+	host := u.Hostname()
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	ip := net.ParseIP(host)
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		entryHost, entryPort := entry, ""
+		if h, p, err := net.SplitHostPort(entry); err == nil {
+			entryHost, entryPort = h, p
+		}
+		if entryPort != "" && entryPort != port {
+			continue
+		}
+
+		entryHost = strings.TrimPrefix(entryHost, "*")
+		entryHost = strings.TrimPrefix(entryHost, ".")
+		host = strings.ToLower(host)
+		if host == entryHost || strings.HasSuffix(host, "."+entryHost) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package esdt
+
+import (
+	"math/rand"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Responses which indicate the cluster is temporarily unable to handle the request
+var retryableStatusCodes = map[int]bool{
+	429: true,
+	502: true,
+	503: true,
+	504: true,
+}
+
+// Whether a request with the method can be sent more than once with the same effect
+func idempotentMethod(method string) bool {
+	switch strings.ToLower(method) {
+	case "get", "head", "put", "delete":
+		return true
+	}
+	return false
+}
+
+// Whether the request failed before it was sent, in which case it is always safe to retry
+func dialError(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	oe, ok := err.(*net.OpError)
+	return ok && oe.Op == "dial"
+}
+
+// The exponential backoff before the given attempt, with full jitter
+func (c *Config) backoff(attempt int) time.Duration {
+	d := c.RetryBackoff
+	for i := 1; i < attempt && d < c.RetryMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > c.RetryMaxBackoff {
+		d = c.RetryMaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// The Elasticsearch URLs requests are balanced across. Conn may hold a comma separated list.
+func (c *Config) hosts() []string {
+	hosts := c.Hosts
+	if len(hosts) == 0 {
+		hosts = strings.Split(c.Conn, ",")
+	}
+
+	var normalized []string
+	for _, v := range hosts {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if !strings.Contains(v, "://") {
+			v = "http://" + v
+		}
+		normalized = append(normalized, v)
+	}
+	return normalized
+}
@@ -0,0 +1,307 @@
+package esdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Resources which are replaced wholesale by a PUT. The state of these resources is
+// captured before an Operation with an auto rollback runs so that it can be restored.
+var overwritableResources = []string{
+	"_template",
+	"_index_template",
+	"_component_template",
+	"_ingest/pipeline",
+	"_ilm/policy",
+	"_scripts",
+}
+
+// Derives the rollback for the common shapes of Operation:
+//
+// PUT <index> is undone by DELETE <index>
+//
+// PUT _template/<name>, _ingest/pipeline/<name> and other named resources are undone by a DELETE
+// of the same URI
+//
+// PUT <index>/_alias/<name> is undone by DELETE <index>/_alias/<name>
+//
+// POST _aliases is undone by swapping the add and remove actions in the body
+//
+// The second return value is false if no rollback could be derived.
+func DeriveRollback(operation *Operation) (RollbackTemplate, bool) {
+	method := strings.ToUpper(operation.Method)
+	p := uriPath(operation.Uri)
+	segments := strings.Split(p, "/")
+
+	if method != "PUT" && method != "POST" {
+		return RollbackTemplate{}, false
+	}
+
+	if p == "_aliases" {
+		return RollbackTemplate{
+			Method: "POST",
+			Uri:    "_aliases",
+			Body:   invertAliasActions(operation.Body),
+		}, true
+	}
+
+	if len(segments) == 3 && (segments[1] == "_alias" || segments[1] == "_aliases") {
+		return RollbackTemplate{
+			Method: "DELETE",
+			Uri:    strings.Join([]string{segments[0], "_alias", segments[2]}, "/"),
+		}, true
+	}
+
+	if method == "PUT" && len(segments) == 1 && p != "" && !strings.HasPrefix(p, "_") {
+		return RollbackTemplate{Method: "DELETE", Uri: p}, true
+	}
+
+	if method == "PUT" && overwritableResource(p) != "" {
+		return RollbackTemplate{Method: "DELETE", Uri: p}, true
+	}
+
+	return RollbackTemplate{}, false
+}
+
+func invertAliasActions(body map[string]interface{}) map[string]interface{} {
+	if body == nil {
+		return nil
+	}
+
+	actions, _ := body["actions"].([]interface{})
+	inverted := make([]interface{}, 0, len(actions))
+	for i := len(actions) - 1; i >= 0; i-- {
+		action, ok := actions[i].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := action["add"]; ok {
+			inverted = append(inverted, map[string]interface{}{"remove": removeAliasTarget(v)})
+		} else if v, ok := action["remove"]; ok {
+			inverted = append(inverted, map[string]interface{}{"add": v})
+		}
+	}
+
+	return map[string]interface{}{"actions": inverted}
+}
+
+// Only the index and alias are accepted when removing an alias, so filters and
+// routing are dropped from the action
+func removeAliasTarget(v interface{}) interface{} {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	target := make(map[string]interface{})
+	for _, k := range []string{"index", "indices", "alias", "aliases"} {
+		if val, ok := m[k]; ok {
+			target[k] = val
+		}
+	}
+	return target
+}
+
+// Returns the overwritable resource prefix the path targets, or an empty string
+func overwritableResource(p string) string {
+	for _, v := range overwritableResources {
+		if strings.HasPrefix(p, v+"/") && len(p) > len(v)+1 {
+			return v
+		}
+	}
+	return ""
+}
+
+func settingsResource(p string) bool {
+	segments := strings.Split(p, "/")
+	return len(segments) == 2 && segments[1] == "_settings" && !strings.HasPrefix(segments[0], "_")
+}
+
+// Strips the leading slash and query string from a URI
+func uriPath(uri string) string {
+	if i := strings.Index(uri, "?"); i >= 0 {
+		uri = uri[:i]
+	}
+	return strings.Trim(strings.TrimSpace(uri), "/")
+}
+
+// Captures the state of the resource an Operation overwrites so that an auto rollback
+// can restore it. An empty string is returned if the resource does not exist yet or
+// is not one that is overwritten.
+func (e *esdtImpl) capturePreviousState(operation *Operation) (string, error) {
+	method := strings.ToUpper(operation.Method)
+	if method != "PUT" && method != "POST" {
+		return "", nil
+	}
+
+	p := uriPath(operation.Uri)
+	var uri string
+	if overwritableResource(p) != "" {
+		uri = p
+	} else if settingsResource(p) {
+		uri = p + "?flat_settings=true"
+	} else {
+		return "", nil
+	}
+
+	res, err := e.runEsQuery(uri, "get", nil)
+	if err != nil {
+		return "", err
+	}
+	if res == nil {
+		return "", errors.New("did not receive a response from elasticsearch")
+	}
+
+	if res.Response().StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+
+	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
+		return "", errors.New(fmt.Sprintf("Could not capture the state of %s: %s", p, res.Response().Status))
+	}
+
+	return res.String(), nil
+}
+
+// Resolves the queries which undo an Operation whose rollback is in auto mode. If the
+// Operation overwrote a resource, its previous state is restored. Otherwise the rollback
+// is derived from the Operation.
+func autoRollbackTemplates(operation *Operation, previous string) ([]RollbackTemplate, error) {
+	if previous == "" {
+		rollback, ok := DeriveRollback(operation)
+		if !ok {
+			return nil, errors.New(NoRollbackFieldErrorMsg)
+		}
+		return []RollbackTemplate{rollback}, nil
+	}
+
+	var state map[string]interface{}
+	err := json.Unmarshal([]byte(previous), &state)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Could not parse the previous state of %s", operation.Id))
+	}
+
+	p := uriPath(operation.Uri)
+	if settingsResource(p) {
+		return restoreSettingsTemplates(operation, state), nil
+	}
+
+	resource := overwritableResource(p)
+	name := p[len(resource)+1:]
+	var body map[string]interface{}
+
+	if resource == "_scripts" {
+		body = map[string]interface{}{"script": state["script"]}
+	} else {
+		body = parseResources(resource, state)[name]
+	}
+
+	if body == nil {
+		return nil, errors.New(fmt.Sprintf("Could not find the previous state of %s", p))
+	}
+
+	return []RollbackTemplate{{Method: "PUT", Uri: p, Body: body}}, nil
+}
+
+// Parses the response to a GET of overwritable resources into the bodies which would PUT
+// them, keyed by name. Stored scripts are not keyed by name in the response, so are not parsed.
+func parseResources(resource string, state map[string]interface{}) map[string]map[string]interface{} {
+	resources := make(map[string]map[string]interface{})
+
+	switch resource {
+	case "_index_template", "_component_template":
+		key := strings.TrimPrefix(resource, "_")
+		list, _ := state[key+"s"].([]interface{})
+		for _, v := range list {
+			item, _ := v.(map[string]interface{})
+			name, _ := item["name"].(string)
+			if body, ok := item[key].(map[string]interface{}); ok && name != "" {
+				resources[name] = body
+			}
+		}
+	case "_ilm/policy":
+		for name, v := range state {
+			item, _ := v.(map[string]interface{})
+			if policy, ok := item["policy"].(map[string]interface{}); ok {
+				resources[name] = map[string]interface{}{"policy": policy}
+			}
+		}
+	default:
+		for name, v := range state {
+			if body, ok := v.(map[string]interface{}); ok {
+				resources[name] = body
+			}
+		}
+	}
+
+	return resources
+}
+
+// Restores the settings an Operation changed to the values they held before it ran.
+// Settings which were not set before are reset to their defaults.
+func restoreSettingsTemplates(operation *Operation, state map[string]interface{}) []RollbackTemplate {
+	changed := make(map[string]interface{})
+	flattenSettings("", operation.Body, changed)
+
+	indices := make([]string, 0, len(state))
+	for k := range state {
+		indices = append(indices, k)
+	}
+	sort.Strings(indices)
+
+	var templates []RollbackTemplate
+	for _, index := range indices {
+		v, _ := state[index].(map[string]interface{})
+		settings, _ := v["settings"].(map[string]interface{})
+
+		body := make(map[string]interface{})
+		for k := range changed {
+			body[k] = settings[k]
+		}
+
+		templates = append(templates, RollbackTemplate{
+			Method: "PUT",
+			Uri:    index + "/_settings",
+			Body:   body,
+		})
+	}
+
+	return templates
+}
+
+// Flattens a settings body into the dotted keys Elasticsearch returns with flat_settings
+func flattenSettings(prefix string, in map[string]interface{}, out map[string]interface{}) {
+	for k, v := range in {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if m, ok := v.(map[string]interface{}); ok {
+			flattenSettings(key, m, out)
+			continue
+		}
+		if !strings.HasPrefix(key, "index.") {
+			key = "index." + key
+		}
+		out[key] = v
+	}
+}
+
+func (e *esdtImpl) runAutoRollback(operation *Operation, previous string) error {
+	templates, err := autoRollbackTemplates(operation, previous)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range templates {
+		err = e.runEsQueryAndValidate(v.Uri, v.Method, v.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package esdt
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// References to secrets within config.yml values:
+//
+// ${env:NAME} is replaced by the environment variable NAME
+//
+// ${file:/path} is replaced by the contents of the file
+//
+// ${cmd:command} is replaced by the output of the command
+var secretRefRegEx = regexp.MustCompile(`\$\{(env|file|cmd):([^}]*)\}`)
+
+const redacted = "xxxxx"
+
+// Replaces the secret references in every string field of the Config
+func resolveSecretRefs(c *Config) error {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.Kind() != reflect.String || !f.CanSet() {
+			continue
+		}
+
+		var err error
+		resolved := secretRefRegEx.ReplaceAllStringFunc(f.String(), func(ref string) string {
+			m := secretRefRegEx.FindStringSubmatch(ref)
+			s, e := resolveSecretRef(m[1], strings.TrimSpace(m[2]))
+			if e != nil && err == nil {
+				err = errors.Wrap(e, fmt.Sprintf("Could not resolve %s in %s", ref, v.Type().Field(i).Name))
+			}
+			return s
+		})
+		if err != nil {
+			return err
+		}
+		f.SetString(resolved)
+	}
+	return nil
+}
+
+func resolveSecretRef(kind string, ref string) (string, error) {
+	switch kind {
+	case "env":
+		s, ok := os.LookupEnv(ref)
+		if !ok {
+			return "", errors.New(fmt.Sprintf("environment variable %s is not set", ref))
+		}
+		return s, nil
+	case "file":
+		return readSecretFile(ref)
+	case "cmd":
+		out, err := exec.Command("sh", "-c", ref).Output()
+		if err != nil {
+			return "", errors.New(fmt.Sprintf("command failed: %s", err.Error()))
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	return "", errors.New(fmt.Sprintf("unknown secret reference %s", kind))
+}
+
+func readSecretFile(file string) (string, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", errors.New(fmt.Sprintf("Problems reading secret file %s", file))
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// Reads the credentials given as files, unless the credential itself was given
+func resolveSecretFiles(c *Config) error {
+	files := []struct {
+		file   string
+		secret *string
+	}{
+		{c.PasswordFile, &c.Password},
+		{c.ApiKeyFile, &c.ApiKey},
+		{c.BearerTokenFile, &c.BearerToken},
+	}
+
+	for _, v := range files {
+		if v.file == "" || *v.secret != "" {
+			continue
+		}
+		s, err := readSecretFile(v.file)
+		if err != nil {
+			return err
+		}
+		*v.secret = s
+	}
+	return nil
+}
+
+// Removes every secret in the Config from the string, so that it can be logged
+func (c *Config) redact(s string) string {
+	secrets := []string{c.Password, c.ApiKey, c.BearerToken}
+	for _, v := range append(c.hosts(), c.Proxy) {
+		if u, err := url.Parse(v); err == nil && u.User != nil {
+			if pw, ok := u.User.Password(); ok {
+				secrets = append(secrets, pw, url.QueryEscape(pw))
+			}
+		}
+	}
+
+	for _, v := range secrets {
+		if v != "" {
+			s = strings.Replace(s, v, redacted, -1)
+		}
+	}
+	return s
+}
@@ -0,0 +1,289 @@
+package esdt
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+type awsCredentials struct {
+	AccessKeyId     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// Signs every request with AWS Signature Version 4 before passing it on to the
+// underlying transport
+type sigV4Transport struct {
+	base        http.RoundTripper
+	credentials *awsCredentials
+	region      string
+	service     string
+}
+
+func newSigV4Transport(c *Config, base http.RoundTripper) (*sigV4Transport, error) {
+	credentials, err := loadAwsCredentials(c.AwsProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	region := c.AwsRegion
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, errors.New("An AWS region is required to sign requests")
+	}
+
+	service := c.AwsService
+	if service == "" {
+		service = DefaultAwsService
+	}
+
+	return &sigV4Transport{
+		base:        base,
+		credentials: credentials,
+		region:      region,
+		service:     service,
+	}, nil
+}
+
+func (t *sigV4Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var body []byte
+	if r.Body != nil {
+		b, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+	}
+
+	signed := new(http.Request)
+	*signed = *r
+	signed.Header = make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		signed.Header[k] = append([]string(nil), v...)
+	}
+	if body != nil {
+		signed.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	t.sign(signed, body, time.Now())
+
+	return t.base.RoundTrip(signed)
+}
+
+// Signs a request with AWS Signature Version 4 as of the given time, as every request is
+// signed with the aws-sigv4 AuthMode
+func SignAwsSigV4(r *http.Request, body []byte, accessKeyId string, secretAccessKey string, region string, service string, now time.Time) {
+	t := &sigV4Transport{
+		credentials: &awsCredentials{AccessKeyId: accessKeyId, SecretAccessKey: secretAccessKey},
+		region:      region,
+		service:     service,
+	}
+	t.sign(r, body, now)
+}
+
+func (t *sigV4Transport) sign(r *http.Request, body []byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	r.Header.Del("Authorization")
+	r.Header.Set("X-Amz-Date", amzDate)
+	if t.credentials.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", t.credentials.SessionToken)
+	}
+
+	host := r.Host
+	if host == "" {
+		host = r.URL.Host
+	}
+
+	headers := map[string]string{"host": host}
+	for k, v := range r.Header {
+		k = strings.ToLower(k)
+		if strings.HasPrefix(k, "x-amz-") {
+			headers[k] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		canonicalUri(r),
+		canonicalQuery(r),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hashHex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, t.region, t.service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+t.credentials.SecretAccessKey), date)
+	key = hmacSha256(key, t.region)
+	key = hmacSha256(key, t.service)
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, t.credentials.AccessKeyId, scope, signedHeaders, signature))
+}
+
+// The path is encoded once more on top of its escaped form, as required for every
+// service but S3
+func canonicalUri(r *http.Request) string {
+	p := r.URL.EscapedPath()
+	if p == "" {
+		return "/"
+	}
+	return sigV4Escape(p, false)
+}
+
+func canonicalQuery(r *http.Request) string {
+	query := r.URL.Query()
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			pairs = append(pairs, sigV4Escape(k, true)+"="+sigV4Escape(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// Percent encodes everything but the unreserved characters, and the slash unless encodeSlash is set
+func sigV4Escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || (c == '/' && !encodeSlash) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hashHex(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// Loads AWS credentials from the standard environment variables, falling back to the
+// shared credentials file
+func loadAwsCredentials(profile string) (*awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return &awsCredentials{
+			AccessKeyId:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, errors.New("Could not find the AWS shared credentials file")
+		}
+		file = filepath.Join(home, ".aws", "credentials")
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("No AWS credentials found in the environment or %s", file))
+	}
+	defer f.Close()
+
+	credentials := &awsCredentials{}
+	section := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		switch strings.TrimSpace(kv[0]) {
+		case "aws_access_key_id":
+			credentials.AccessKeyId = value
+		case "aws_secret_access_key":
+			credentials.SecretAccessKey = value
+		case "aws_session_token":
+			credentials.SessionToken = value
+		}
+	}
+
+	if credentials.AccessKeyId == "" || credentials.SecretAccessKey == "" {
+		return nil, errors.New(fmt.Sprintf("No AWS credentials found for profile %s in %s", profile, file))
+	}
+
+	return credentials, nil
+}
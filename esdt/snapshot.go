@@ -0,0 +1,264 @@
+package esdt
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var invalidSnapshotChars = regexp.MustCompile(`[\\/*?"<>|,# ]`)
+
+type snapshotRes struct {
+	Snapshot snapshotInfo `json:"snapshot"`
+}
+
+type snapshotsRes struct {
+	Snapshots []snapshotInfo `json:"snapshots"`
+}
+
+type snapshotInfo struct {
+	Snapshot string   `json:"snapshot"`
+	State    string   `json:"state"`
+	Indices  []string `json:"indices"`
+}
+
+// The repository to snapshot into before the Operation runs. The Operation's own setting
+// takes precedence over the Config.
+func (e *esdtImpl) snapshotRepo(operation *Operation) string {
+	if operation.Snapshot != "" {
+		return operation.Snapshot
+	}
+	return e.Config.SnapshotRepo
+}
+
+// The APIs which do not change the data in any index, so Operations using them are not
+// snapshotted
+var indexFreeApis = []string{
+	"_cluster", "_ingest", "_ilm", "_slm", "_snapshot", "_security", "_license", "_scripts",
+	"_template", "_index_template", "_component_template", "_nodes", "_tasks",
+}
+
+// The indices an Operation changes, which are snapshotted before it runs. They are listed by
+// snapshot_indices, taken from the first segment of the URI, or taken from the body of
+// _reindex and _aliases. An empty list is returned if the Operation does not change any
+// index, and an error if the indices cannot be told, rather than snapshotting every index.
+func affectedIndices(operation *Operation) ([]string, error) {
+	if len(operation.SnapshotIndices) > 0 {
+		return operation.SnapshotIndices, nil
+	}
+
+	p := uriPath(operation.Uri)
+	target := strings.Split(p, "/")[0]
+	if target != "" && !strings.HasPrefix(target, "_") {
+		return strings.Split(target, ","), nil
+	}
+
+	switch target {
+	case "_reindex":
+		// Only the destination is written to
+		dest, _ := operation.Body["dest"].(map[string]interface{})
+		if indices := indexNames(dest["index"]); len(indices) > 0 {
+			return indices, nil
+		}
+	case "_aliases":
+		var indices []string
+		actions, _ := operation.Body["actions"].([]interface{})
+		for _, a := range actions {
+			action, _ := a.(map[string]interface{})
+			for _, options := range action {
+				o, _ := options.(map[string]interface{})
+				indices = append(indices, indexNames(o["index"])...)
+				indices = append(indices, indexNames(o["indices"])...)
+			}
+		}
+		if len(indices) > 0 {
+			return indices, nil
+		}
+	default:
+		for _, v := range indexFreeApis {
+			if target == v {
+				return nil, nil
+			}
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("Cannot tell which indices %s changes, list them in snapshot_indices", operation.Id))
+}
+
+// The index names given as a string or a list of strings
+func indexNames(v interface{}) []string {
+	switch t := v.(type) {
+	case string:
+		return strings.Split(t, ",")
+	case []interface{}:
+		var names []string
+		for _, n := range t {
+			if name, ok := n.(string); ok {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	return nil
+}
+
+func snapshotName(id string) string {
+	name := invalidSnapshotChars.ReplaceAllString(strings.ToLower(id), "_")
+	name = strings.TrimLeft(name, "_-")
+	return fmt.Sprintf("esdt-%s-%s", name, time.Now().Format("20060102150405"))
+}
+
+// Snapshots the indices an Operation changes into the given repository, recording the
+// snapshot, the indices in it and the indices which do not exist yet on the operations record.
+// No snapshot is taken if the Operation does not change any index.
+func (e *esdtImpl) createSnapshot(operation *Operation, repo string, record *operations) error {
+	indices, err := affectedIndices(operation)
+	if err != nil || len(indices) == 0 {
+		return err
+	}
+
+	// Indices which do not exist are left out of the snapshot, so Restore deletes them instead
+	var created []string
+	for _, v := range indices {
+		if strings.ContainsAny(v, "*?") || strings.HasPrefix(v, "-") {
+			continue
+		}
+		exists, err := e.indexExists(v)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			created = append(created, v)
+		}
+	}
+
+	name := snapshotName(operation.Id)
+	body := map[string]interface{}{
+		"indices":              strings.Join(indices, ","),
+		"ignore_unavailable":   true,
+		"include_global_state": false,
+	}
+
+	res, err := e.runEsQuery(fmt.Sprintf("_snapshot/%s/%s?wait_for_completion=true", repo, name), "put", body)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return errors.New("did not receive a response from elasticsearch")
+	}
+
+	if res.Response().StatusCode < 200 || res.Response().StatusCode > 299 {
+		return errors.New(fmt.Sprintf("Failed to snapshot before running %s: %s. Reason: %s", operation.Id, res.Response().Status, res.String()))
+	}
+
+	var s snapshotRes
+	json.NewDecoder(res.Response().Body).Decode(&s)
+
+	if s.Snapshot.State != "SUCCESS" {
+		return errors.New(fmt.Sprintf("Failed to snapshot before running %s: snapshot %s is %s", operation.Id, name, s.Snapshot.State))
+	}
+
+	record.Snapshot = name
+	record.SnapshotRepo = repo
+	record.SnapshotIndices = s.Snapshot.Indices
+	record.CreatedIndices = created
+	return nil
+}
+
+// Whether an index or alias exists
+func (e *esdtImpl) indexExists(index string) (bool, error) {
+	res, err := e.runEsQuery(url.PathEscape(index), "head", nil)
+	if err != nil {
+		return false, err
+	}
+	if res == nil {
+		return false, errors.New("did not receive a response from elasticsearch")
+	}
+
+	switch res.Response().StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, errors.New(fmt.Sprintf("Could not check whether %s exists: %s", index, res.Response().Status))
+}
+
+// Restores the indices of an Operation from the snapshot taken before it ran, deletes the
+// indices it created, then removes its record so that it is run again on the next call to Run
+func (e *esdtImpl) restoreSnapshot(id string) error {
+	record, err := e.getOperationRecord(id)
+	if err != nil {
+		return err
+	}
+
+	if record.Snapshot == "" || record.SnapshotRepo == "" {
+		return errors.New(fmt.Sprintf("No snapshot was taken before %s ran", id))
+	}
+
+	// Only the indices the operation changed are restored, rather than every index in the
+	// snapshot, so that writes to other indices since the snapshot are kept
+	if len(record.SnapshotIndices) == 0 && len(record.CreatedIndices) == 0 {
+		return errors.New(fmt.Sprintf("The indices %s changed were not recorded, restore snapshot %s by hand", id, record.Snapshot))
+	}
+
+	snapshotUri := fmt.Sprintf("_snapshot/%s/%s", record.SnapshotRepo, record.Snapshot)
+	res, err := e.runEsQuery(snapshotUri, "get", nil)
+	if err != nil {
+		return err
+	}
+	if res == nil {
+		return errors.New("did not receive a response from elasticsearch")
+	}
+
+	var s snapshotsRes
+	json.NewDecoder(res.Response().Body).Decode(&s)
+
+	if len(s.Snapshots) == 0 {
+		return errors.New(fmt.Sprintf("Could not find snapshot %s in repository %s", record.Snapshot, record.SnapshotRepo))
+	}
+
+	if len(record.CreatedIndices) > 0 {
+		created := strings.Join(record.CreatedIndices, ",")
+		err = validateEsResponse(e.runEsQueryWithRetry(created+"?ignore_unavailable=true", "delete", nil, nil, true))
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not delete the indices %s created", id))
+		}
+	}
+
+	if len(record.SnapshotIndices) > 0 {
+		err = e.restoreIndices(snapshotUri, strings.Join(record.SnapshotIndices, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	return e.deleteOperationIndex(id)
+}
+
+// Restores the indices from the snapshot. Open indices cannot be restored over, so they are
+// closed first and opened again if the restore fails.
+func (e *esdtImpl) restoreIndices(snapshotUri string, indices string) error {
+	err := validateEsResponse(e.runEsQueryWithRetry(indices+"/_close?ignore_unavailable=true", "post", nil, nil, true))
+	if err != nil {
+		return err
+	}
+
+	err = e.runEsQueryAndValidate(snapshotUri+"/_restore?wait_for_completion=true", "post", map[string]interface{}{
+		"indices":              indices,
+		"include_global_state": false,
+	})
+	if err != nil {
+		openErr := validateEsResponse(e.runEsQueryWithRetry(indices+"/_open?ignore_unavailable=true", "post", nil, nil, true))
+		if openErr != nil {
+			return errors.Wrap(err, fmt.Sprintf("Could not open %s again after the restore failed: %s", indices, openErr.Error()))
+		}
+		return err
+	}
+	return nil
+}
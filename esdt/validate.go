@@ -0,0 +1,227 @@
+package esdt
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Operation filenames are expected to start with the timestamp they were generated at, so
+// that they run in order
+var timestampedFilenameRegEx = regexp.MustCompile(`^\d{14}_`)
+
+// The HTTP methods an Operation can use
+var validMethods = map[string]bool{
+	"GET":    true,
+	"PUT":    true,
+	"POST":   true,
+	"HEAD":   true,
+	"DELETE": true,
+}
+
+// A problem found in an operation file by Validate. Warnings are problems which do not stop
+// the operation from running.
+type ValidationIssue struct {
+	File    string
+	Message string
+	Warning bool
+}
+
+func (v *ValidationIssue) Error() string {
+	return fmt.Sprintf("%s: %s", v.File, v.Message)
+}
+
+// The top level fields of the body an endpoint accepts. Endpoints whose body is not
+// checked have no shape.
+type bodyShape struct {
+	Endpoint string
+	Required []string
+	Allowed  []string
+}
+
+var mappingFields = []string{
+	"properties", "dynamic", "dynamic_templates", "dynamic_date_formats", "date_detection",
+	"numeric_detection", "_source", "_meta", "_routing", "_all", "_field_names", "runtime", "enabled",
+}
+
+var bodyShapes = map[string]bodyShape{
+	"_aliases":            {"_aliases", []string{"actions"}, []string{"actions"}},
+	"_template":           {"an index template", nil, []string{"index_patterns", "template", "order", "version", "settings", "mappings", "aliases"}},
+	"_index_template":     {"an index template", []string{"index_patterns"}, []string{"index_patterns", "template", "composed_of", "priority", "version", "_meta", "data_stream", "allow_auto_create"}},
+	"_component_template": {"a component template", []string{"template"}, []string{"template", "version", "_meta"}},
+	"_ingest/pipeline":    {"an ingest pipeline", []string{"processors"}, []string{"description", "processors", "on_failure", "version", "_meta"}},
+	"_ilm/policy":         {"an ILM policy", []string{"policy"}, []string{"policy"}},
+	"_scripts":            {"a stored script", []string{"script"}, []string{"script"}},
+	"index":               {"index creation", nil, []string{"settings", "mappings", "aliases"}},
+	"_mapping":            {"a mapping update", nil, mappingFields},
+}
+
+func (e *esdtImpl) Validate() ([]*ValidationIssue, error) {
+	files, others, err := e.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	// Files included by operations are not operations themselves
+	included := make(map[string]bool)
+	for _, v := range files {
+		_, includes, _ := e.loadFile(v)
+		for _, p := range includes {
+			included[p] = true
+		}
+	}
+	files = withoutIncluded(files, included)
+	others = withoutIncluded(others, included)
+
+	var issues []*ValidationIssue
+	for _, v := range others {
+		issues = append(issues, &ValidationIssue{
+			File:    v.Path,
+			Message: "Not an operation file, expected a .json, .yml or .yaml file. Add it to exclude to ignore it",
+		})
+	}
+
+	for _, v := range files {
+		issues = append(issues, e.validateFile(v)...)
+	}
+
+	duplicates, ids := duplicateIds(files)
+	for _, v := range ids {
+		issues = append(issues, &ValidationIssue{
+			File:    duplicates[v][0].Path,
+			Message: fmt.Sprintf("Duplicate operation id %s, also in %s", v, joinPaths(duplicates[v][1:])),
+		})
+	}
+
+	return issues, nil
+}
+
+func (e *esdtImpl) validateFile(f operationFile) []*ValidationIssue {
+	filename := f.Path
+	var issues []*ValidationIssue
+	issue := func(warning bool, format string, a ...interface{}) {
+		issues = append(issues, &ValidationIssue{
+			File:    filename,
+			Message: fmt.Sprintf(format, a...),
+			Warning: warning,
+		})
+	}
+
+	if !timestampedFilenameRegEx.MatchString(path.Base(filename)) {
+		issue(true, "Filename does not start with a timestamp, so it may not run in the intended order")
+	}
+
+	content, err := fs.ReadFile(e.Config.files(), f.FullPath())
+	if err != nil {
+		issue(false, "Problems reading file")
+		return issues
+	}
+
+	var operation Operation
+	err = decodeOperation(filename, content, &operation, true)
+	if err != nil && strings.Contains(err.Error(), "unknown field") {
+		issue(false, "Unknown field %s", strings.TrimPrefix(err.Error(), "json: unknown field "))
+		operation = Operation{}
+		err = decodeOperation(filename, content, &operation, false)
+	}
+	if err != nil {
+		issue(false, "Could not parse %s: %s", operationFormat(filename), describeDecodeError(filename, content, err))
+		return issues
+	}
+
+	if _, err := e.resolveIncludes(f, &operation); err != nil {
+		issue(false, "%s", err.Error())
+		return issues
+	}
+
+	method := strings.ToUpper(operation.Method)
+	if !validMethods[method] {
+		issue(false, "Invalid method %q, must be one of GET, PUT, POST, HEAD, DELETE", operation.Method)
+	}
+
+	if operation.Timeout != "" {
+		if _, err := time.ParseDuration(operation.Timeout); err != nil {
+			issue(false, "Invalid timeout %s", operation.Timeout)
+		}
+	}
+
+	rollback := operation.Rollback
+	switch {
+	case rollback.Mode == RollbackModeAuto:
+	case rollback.Mode != "":
+		issue(false, "Invalid rollback mode %s, must be %s", rollback.Mode, RollbackModeAuto)
+	case rollback.Method == "" && rollback.Uri == "":
+		issue(true, "No rollback listed")
+	case rollback.Method == "" || rollback.Uri == "":
+		issue(false, "The rollback needs both a method and a uri")
+	case !validMethods[strings.ToUpper(rollback.Method)]:
+		issue(false, "Invalid rollback method %q, must be one of GET, PUT, POST, HEAD, DELETE", rollback.Method)
+	}
+
+	if method == "PUT" || method == "POST" {
+		if shape, ok := expectedBodyShape(method, uriPath(operation.Uri)); ok {
+			for _, v := range missingFields(operation.Body, shape.Required) {
+				issue(false, "The body is missing %s, which is required for %s", v, shape.Endpoint)
+			}
+			for _, v := range unexpectedFields(operation.Body, shape.Allowed) {
+				issue(false, "The body field %s is not expected for %s", v, shape.Endpoint)
+			}
+		}
+	}
+
+	return issues
+}
+
+// The shape of the body expected by the endpoint the path targets
+func expectedBodyShape(method string, p string) (bodyShape, bool) {
+	if p == "_aliases" {
+		return bodyShapes["_aliases"], true
+	}
+
+	if r := overwritableResource(p); r != "" && method == "PUT" {
+		return bodyShapes[r], true
+	}
+
+	segments := strings.Split(p, "/")
+	if method == "PUT" && len(segments) == 1 && p != "" && !strings.HasPrefix(p, "_") {
+		return bodyShapes["index"], true
+	}
+
+	if len(segments) >= 2 && (segments[1] == "_mapping" || segments[1] == "_mappings") {
+		return bodyShapes["_mapping"], true
+	}
+
+	return bodyShape{}, false
+}
+
+func missingFields(body map[string]interface{}, required []string) []string {
+	var missing []string
+	for _, v := range required {
+		if _, ok := body[v]; !ok {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
+
+func unexpectedFields(body map[string]interface{}, allowed []string) []string {
+	var unexpected []string
+	for k := range body {
+		found := false
+		for _, v := range allowed {
+			if k == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unexpected = append(unexpected, k)
+		}
+	}
+	sort.Strings(unexpected)
+	return unexpected
+}
@@ -13,7 +13,7 @@ var version string
 var GlobalFlags = []cli.Flag{
 	cli.StringFlag{
 		Name:   "c, conn",
-		Usage:  "Specify the Elasticsearch cluster the tool points to. Accepts env variable ELASTICSEARCH_URL.\tDefault: " + esdt.DefaultConnUrl,
+		Usage:  "Specify the Elasticsearch cluster the tool points to. Accepts a comma separated list of hosts and env variable ELASTICSEARCH_URL.\tDefault: " + esdt.DefaultConnUrl,
 		EnvVar: "ELASTICSEARCH_URL",
 	},
 	cli.StringFlag{
@@ -42,6 +42,91 @@ var GlobalFlags = []cli.Flag{
 		Usage:  "The password for the Elasticsearch cluster. Accepts env variable ESDT_PASSWORD\tDefault: \"\"",
 		EnvVar: "ESDT_PASSWORD",
 	},
+	cli.StringFlag{
+		Name:   "pw-file, password-file",
+		Usage:  "A file containing the password for the Elasticsearch cluster. Accepts env variable ESDT_PASSWORD_FILE\tDefault: \"\"",
+		EnvVar: "ESDT_PASSWORD_FILE",
+	},
+	cli.StringFlag{
+		Name:   "api-key",
+		Usage:  "The API key for the Elasticsearch cluster, encoded or as id:api_key. Accepts env variable ESDT_API_KEY\tDefault: \"\"",
+		EnvVar: "ESDT_API_KEY",
+	},
+	cli.StringFlag{
+		Name:   "token, bearer-token",
+		Usage:  "The bearer token for the Elasticsearch cluster. Accepts env variable ESDT_BEARER_TOKEN\tDefault: \"\"",
+		EnvVar: "ESDT_BEARER_TOKEN",
+	},
+	cli.StringFlag{
+		Name:   "auth-mode",
+		Usage:  "How requests are authenticated. Set to aws-sigv4 to sign requests for Amazon OpenSearch Service. Accepts env variable ESDT_AUTH_MODE\tDefault: \"\"",
+		EnvVar: "ESDT_AUTH_MODE",
+	},
+	cli.StringFlag{
+		Name:   "aws-region",
+		Usage:  "The AWS region requests are signed for. Accepts env variable AWS_REGION\tDefault: \"\"",
+		EnvVar: "AWS_REGION",
+	},
+	cli.StringFlag{
+		Name:   "aws-service",
+		Usage:  "The AWS service requests are signed for. Accepts env variable ESDT_AWS_SERVICE\tDefault: " + esdt.DefaultAwsService,
+		EnvVar: "ESDT_AWS_SERVICE",
+	},
+	cli.StringFlag{
+		Name:   "aws-profile",
+		Usage:  "The profile used from the AWS shared credentials file. Accepts env variable AWS_PROFILE\tDefault: default",
+		EnvVar: "AWS_PROFILE",
+	},
+	cli.StringSliceFlag{
+		Name:   "exclude",
+		Usage:  "A glob pattern of files in the target directory which are not data templates e.g. \"*.bak\". Can be repeated. Accepts env variable ESDT_EXCLUDE\tOptional",
+		EnvVar: "ESDT_EXCLUDE",
+	},
+	cli.StringFlag{
+		Name:   "proxy",
+		Usage:  "The HTTP proxy requests are sent through. Hosts in NO_PROXY bypass it. Accepts env variable ESDT_PROXY\tDefault: HTTP_PROXY",
+		EnvVar: "ESDT_PROXY",
+	},
+	cli.StringSliceFlag{
+		Name:   "header, H",
+		Usage:  "A header sent with every request e.g. \"X-Tenant: acme\". Can be repeated. Accepts env variable ESDT_HEADERS\tOptional",
+		EnvVar: "ESDT_HEADERS",
+	},
+	cli.DurationFlag{
+		Name:   "timeout",
+		Usage:  "The deadline for the command e.g. 5m. Accepts env variable ESDT_TIMEOUT\tDefault: none",
+		EnvVar: "ESDT_TIMEOUT",
+	},
+	cli.IntFlag{
+		Name:   "max-attempts",
+		Usage:  "The number of times a request is attempted before giving up. Accepts env variable ESDT_MAX_ATTEMPTS\tDefault: 3",
+		EnvVar: "ESDT_MAX_ATTEMPTS",
+	},
+	cli.StringFlag{
+		Name:   "ca, ca-cert",
+		Usage:  "The PEM encoded CA bundle used to verify the Elasticsearch cluster. Accepts env variable ESDT_CA_CERT\tDefault: \"\"",
+		EnvVar: "ESDT_CA_CERT",
+	},
+	cli.StringFlag{
+		Name:   "cert, client-cert",
+		Usage:  "The PEM encoded client certificate for mutual TLS. Accepts env variable ESDT_CLIENT_CERT\tDefault: \"\"",
+		EnvVar: "ESDT_CLIENT_CERT",
+	},
+	cli.StringFlag{
+		Name:   "key, client-key",
+		Usage:  "The PEM encoded client key for mutual TLS. Accepts env variable ESDT_CLIENT_KEY\tDefault: \"\"",
+		EnvVar: "ESDT_CLIENT_KEY",
+	},
+	cli.StringFlag{
+		Name:   "server-name",
+		Usage:  "The server name used to verify the Elasticsearch cluster's certificate. Accepts env variable ESDT_SERVER_NAME\tDefault: \"\"",
+		EnvVar: "ESDT_SERVER_NAME",
+	},
+	cli.BoolFlag{
+		Name:   "insecure",
+		Usage:  "Skip verification of the Elasticsearch cluster's certificate. Accepts env variable ESDT_INSECURE\tDefault: false",
+		EnvVar: "ESDT_INSECURE",
+	},
 }
 
 func main() {
@@ -55,6 +140,14 @@ func main() {
 		commands.RunCommand,
 		commands.GenerateCommand,
 		commands.RollbackCommand,
+		commands.RedoCommand,
+		commands.RestoreCommand,
+		commands.BaselineCommand,
+		commands.MarkCommand,
+		commands.ValidateCommand,
+		commands.ApplyCommand,
+		commands.DiffMappingCommand,
+		commands.DriftCommand,
 	}
 
 	app.CustomAppHelpTemplate = commands.AppHelpTemplate
@@ -0,0 +1,240 @@
+package tests
+
+import (
+	"encoding/json"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// Holds index templates, pipelines and aliases in memory, responding as Elasticsearch does
+type resourceEs struct {
+	mu        sync.Mutex
+	templates map[string]interface{}
+	pipelines map[string]interface{}
+	aliases   map[string]map[string]interface{}
+	writes    []string
+}
+
+func (s *resourceEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	if r.Method != "GET" {
+		s.writes = append(s.writes, r.Method+" "+r.URL.Path)
+	}
+
+	p := strings.Trim(r.URL.Path, "/")
+	switch {
+	case p == "_index_template" && r.Method == "GET":
+		list := []interface{}{}
+		for k, v := range s.templates {
+			list = append(list, map[string]interface{}{"name": k, "index_template": v})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"index_templates": list})
+	case strings.HasPrefix(p, "_index_template/"):
+		s.store(s.templates, strings.TrimPrefix(p, "_index_template/"), r.Method, body)
+	case p == "_ingest/pipeline" && r.Method == "GET":
+		if len(s.pipelines) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(s.pipelines)
+	case strings.HasPrefix(p, "_ingest/pipeline/"):
+		s.store(s.pipelines, strings.TrimPrefix(p, "_ingest/pipeline/"), r.Method, body)
+	case p == "_alias" && r.Method == "GET":
+		state := make(map[string]interface{})
+		for index, aliases := range s.aliases {
+			state[index] = map[string]interface{}{"aliases": aliases}
+		}
+		json.NewEncoder(w).Encode(state)
+	case p == "_aliases":
+		actions, _ := body["actions"].([]interface{})
+		for _, v := range actions {
+			action := v.(map[string]interface{})
+			if add, ok := action["add"].(map[string]interface{}); ok {
+				index, alias := add["index"].(string), add["alias"].(string)
+				delete(add, "index")
+				delete(add, "alias")
+				if s.aliases[index] == nil {
+					s.aliases[index] = make(map[string]interface{})
+				}
+				s.aliases[index][alias] = add
+			}
+			if remove, ok := action["remove"].(map[string]interface{}); ok {
+				delete(s.aliases[remove["index"].(string)], remove["alias"].(string))
+			}
+		}
+		w.Write([]byte("{}"))
+	default:
+		w.Write([]byte("{}"))
+	}
+}
+
+func (s *resourceEs) store(resources map[string]interface{}, name string, method string, body map[string]interface{}) {
+	switch method {
+	case "PUT":
+		resources[name] = body
+	case "DELETE":
+		delete(resources, name)
+	}
+}
+
+func (s *resourceEs) Writes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	writes := s.writes
+	s.writes = nil
+	return writes
+}
+
+func TestApply(t *testing.T) {
+	stub := &resourceEs{
+		templates: map[string]interface{}{
+			// Matches its declaration once Elasticsearch has normalised the settings
+			"users": map[string]interface{}{
+				"index_patterns": []interface{}{"users-*"},
+				"composed_of":    []interface{}{},
+				"template": map[string]interface{}{
+					"settings": map[string]interface{}{"index": map[string]interface{}{"number_of_shards": "1"}},
+				},
+				"_meta": map[string]interface{}{"managed_by": "esdt"},
+			},
+		},
+		pipelines: map[string]interface{}{
+			"retired": map[string]interface{}{"processors": []interface{}{}, "_meta": map[string]interface{}{"managed_by": "esdt"}},
+			"manual":  map[string]interface{}{"processors": []interface{}{}},
+		},
+		aliases: map[string]map[string]interface{}{
+			"users-1": {"users": map[string]interface{}{}},
+			"users-2": {},
+		},
+	}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"resources/index_templates/users.json": {Data: []byte("{ \"index_patterns\": [\"users-*\"], \"template\": { \"settings\": { \"number_of_shards\": 1 } } }")},
+		"resources/pipelines/lowercase.yml":    {Data: []byte("processors:\n  - lowercase: { field: name }\n")},
+		"resources/aliases/users.yml":          {Data: []byte("indices:\n  users-2: { is_write_index: true }\n")},
+		"resources/README.md":                  {Data: []byte("# Resources")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, ResourcesDir: "resources", Conn: server.URL})
+
+	changes, err := e.PlanResources(true)
+	assert.Nil(t, err)
+	var planned []string
+	for _, v := range changes {
+		planned = append(planned, v.String())
+	}
+	assert.Equal(t, []string{"create pipelines/lowercase", "update aliases/users", "delete pipelines/retired"}, planned)
+	assert.Empty(t, stub.Writes())
+
+	changes, err = e.Apply(true)
+	assert.Nil(t, err)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, []string{"PUT /_ingest/pipeline/lowercase", "POST /_aliases", "DELETE /_ingest/pipeline/retired"}, stub.Writes())
+
+	assert.Contains(t, stub.pipelines, "manual")
+	assert.Equal(t, map[string]interface{}{"managed_by": "esdt"}, stub.pipelines["lowercase"].(map[string]interface{})["_meta"])
+	assert.Empty(t, stub.aliases["users-1"])
+	assert.Equal(t, map[string]interface{}{"is_write_index": true}, stub.aliases["users-2"]["users"])
+
+	changes, err = e.Apply(true)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, stub.Writes())
+}
+
+func TestApplyInvalidResource(t *testing.T) {
+	fsys := fstest.MapFS{
+		"resources/pipelines/broken.json": {Data: []byte("{ \"processors\": [ }")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, ResourcesDir: "resources", Conn: "http://localhost:9200"})
+
+	_, err := e.Apply(false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "resources/pipelines/broken.json")
+}
+
+// Responds as Elasticsearch 6 does, which only has legacy templates, recording the paths read
+type legacyResourceEs struct {
+	resourceEs
+	reads []string
+}
+
+func (s *legacyResourceEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" {
+		s.mu.Lock()
+		s.reads = append(s.reads, r.URL.Path)
+		s.mu.Unlock()
+	}
+
+	p := strings.Trim(r.URL.Path, "/")
+	switch {
+	case p == "_component_template" || p == "_index_template":
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{ "error": { "type": "invalid_index_name_exception" }, "status": 400 }`))
+	case p == "_ilm/policy":
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{ "error": "no handler found for uri [/_ilm/policy] and method [GET]" }`))
+	case p == "_template" && r.Method == "GET":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		json.NewEncoder(w).Encode(s.templates)
+	case strings.HasPrefix(p, "_template/"):
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.writes = append(s.writes, r.Method+" "+r.URL.Path)
+		s.store(s.templates, strings.TrimPrefix(p, "_template/"), r.Method, body)
+	default:
+		s.resourceEs.ServeHTTP(w, r)
+	}
+}
+
+func TestApplyLegacyTemplates(t *testing.T) {
+	stub := &legacyResourceEs{resourceEs: resourceEs{
+		templates: map[string]interface{}{
+			"orders": map[string]interface{}{"order": 0, "index_patterns": []interface{}{"orders-*"}, "settings": map[string]interface{}{}, "mappings": map[string]interface{}{}, "aliases": map[string]interface{}{}},
+		},
+		pipelines: map[string]interface{}{},
+		aliases:   map[string]map[string]interface{}{},
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"resources/legacy_templates/users.json":  {Data: []byte(`{ "index_patterns": ["users-*"], "settings": { "number_of_shards": 1 } }`)},
+		"resources/legacy_templates/orders.json": {Data: []byte(`{ "index_patterns": ["orders-*"] }`)},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, ResourcesDir: "resources", Conn: server.URL})
+
+	// Only the declared kinds are read
+	changes, err := e.Apply(false)
+	assert.Nil(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, "create legacy_templates/users", changes[0].String())
+	assert.NotContains(t, stub.reads, "/_index_template")
+	assert.NotContains(t, stub.reads, "/_ilm/policy")
+	assert.Equal(t, []string{"PUT /_template/users"}, stub.Writes())
+
+	// Legacy templates cannot carry the esdt marker
+	assert.NotContains(t, stub.templates["users"], "_meta")
+
+	// The APIs the cluster does not have are read as empty when pruning
+	changes, err = e.Apply(true)
+	assert.Nil(t, err)
+	assert.Empty(t, changes)
+	assert.Empty(t, stub.Writes())
+}
@@ -0,0 +1,38 @@
+package tests
+
+import (
+	"encoding/base64"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthHeaders(t *testing.T) {
+	cases := []struct {
+		config   esdt.Config
+		expected string
+	}{
+		{esdt.Config{}, ""},
+		{esdt.Config{Username: "elastic", Password: "p@ss:w/rd"}, "Basic " + base64.StdEncoding.EncodeToString([]byte("elastic:p@ss:w/rd"))},
+		{esdt.Config{BearerToken: "token", Username: "elastic"}, "Bearer token"},
+		{esdt.Config{ApiKey: "id:key", BearerToken: "token"}, "ApiKey " + base64.StdEncoding.EncodeToString([]byte("id:key"))},
+		{esdt.Config{ApiKey: "ZW5jb2RlZA=="}, "ApiKey ZW5jb2RlZA=="},
+	}
+
+	for _, c := range cases {
+		stub := &stubEs{}
+		server := httptest.NewServer(stub)
+
+		config := c.config
+		config.Conn = server.URL
+		e := esdt.New(&config)
+		assert.Nil(t, e.Run(&esdt.Operation{Id: "auth_operation", Method: "PUT", Uri: "test"}))
+
+		for _, r := range stub.Requests() {
+			assert.Equal(t, c.expected, r.Header.Get("Authorization"))
+			assert.Nil(t, r.URL.User)
+		}
+		server.Close()
+	}
+}
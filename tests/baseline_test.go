@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// The paths of the operations records written
+func recordsWritten(stub *stubEs) []string {
+	var paths []string
+	for _, r := range stub.Requests() {
+		if r.Method == "POST" {
+			paths = append(paths, r.URL.Path)
+		}
+	}
+	return paths
+}
+
+func TestBaselineSkippedOperation(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_a.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"a\" }")},
+		"ops/20181102000000_b.json": {Data: []byte("{ \"method\": \"PUT\", ")},
+		"ops/20181103000000_c.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"c\" }")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL, SkipInvalid: true})
+	err := e.Baseline("20181102000000_b")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not find operation 20181102000000_b")
+	assert.Empty(t, recordsWritten(stub))
+
+	fsys["ops/20181102000000_b.json"] = &fstest.MapFile{Data: []byte("{ \"method\": \"PUT\", \"uri\": \"b\" }")}
+	e = esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL, Exclude: []string{"*_b.json"}})
+	err = e.Baseline("20181102000000_b")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not find operation 20181102000000_b")
+	assert.Empty(t, recordsWritten(stub))
+
+	e = esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL})
+	assert.Nil(t, e.Baseline("20181102000000_b"))
+	assert.Equal(t, []string{"/operations/_doc/20181101000000_a", "/operations/_doc/20181102000000_b"}, recordsWritten(stub))
+}
+
+// Rejects the record of one operation
+type rejectingEs struct {
+	stubEs
+	reject string
+}
+
+func (s *rejectingEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" && r.URL.Path == s.reject {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.stubEs.ServeHTTP(w, r)
+}
+
+func TestBaselineRecordFailure(t *testing.T) {
+	stub := &rejectingEs{reject: "/operations/_doc/20181101000000_a"}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_a.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"a\" }")},
+		"ops/20181102000000_b.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"b\" }")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL, MaxAttempts: 1})
+	err := e.Baseline("20181102000000_b")
+	assert.NotNil(t, err)
+	assert.IsType(t, esdt.BaselineErrors{}, err)
+	assert.Len(t, err.(esdt.BaselineErrors), 1)
+	assert.Contains(t, err.Error(), "20181101000000_a")
+	assert.Contains(t, recordsWritten(&stub.stubEs), "/operations/_doc/20181102000000_b")
+}
@@ -0,0 +1,155 @@
+package tests
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var tlsOp = &esdt.Operation{
+	Id:     "tls_operation",
+	Method: "PUT",
+	Uri:    "test",
+}
+
+func TestTLS(t *testing.T) {
+	server := httptest.NewTLSServer(&stubEs{})
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(ca, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), os.ModePerm)
+	assert.Nil(t, err)
+
+	e := esdt.New(&esdt.Config{
+		Conn: server.URL,
+	})
+	assert.Error(t, e.Run(tlsOp))
+
+	e = esdt.New(&esdt.Config{
+		Conn:   server.URL,
+		CACert: ca,
+	})
+	assert.Nil(t, e.Run(tlsOp))
+
+	e = esdt.New(&esdt.Config{
+		Conn:     server.URL,
+		Insecure: true,
+	})
+	assert.Nil(t, e.Run(tlsOp))
+
+	e = esdt.New(&esdt.Config{
+		Conn:   server.URL,
+		CACert: filepath.Join(dir, "missing.pem"),
+	})
+	assert.EqualError(t, e.Run(tlsOp), "Problems reading CA certificate "+filepath.Join(dir, "missing.pem"))
+}
+
+// Issues a certificate signed by the parent, or a self-signed CA if parent is nil, writing the
+// certificate and key as PEM files named after it
+func issueCert(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, template *x509.Certificate) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.Nil(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name+"-key.pem"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), os.ModePerm))
+
+	return cert, key
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	ca, caKey := issueCert(t, dir, "ca", nil, nil, &x509.Certificate{
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	})
+	// The server certificate is only valid for es.internal, not the address it listens on
+	issueCert(t, dir, "server", ca, caKey, &x509.Certificate{
+		DNSNames:    []string{"es.internal"},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	issueCert(t, dir, "client", ca, caKey, &x509.Certificate{
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	serverCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem"))
+	assert.Nil(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	server := httptest.NewUnstartedServer(&stubEs{})
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	config := func() *esdt.Config {
+		return &esdt.Config{
+			Conn:       server.URL,
+			CACert:     filepath.Join(dir, "ca.pem"),
+			ClientCert: filepath.Join(dir, "client.pem"),
+			ClientKey:  filepath.Join(dir, "client-key.pem"),
+			ServerName: "es.internal",
+		}
+	}
+
+	assert.Nil(t, esdt.New(config()).Run(tlsOp))
+
+	// The host in Conn does not match the server certificate
+	c := config()
+	c.ServerName = ""
+	err = esdt.New(c).Run(tlsOp)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "x509")
+
+	// The server requires a client certificate
+	c = config()
+	c.ClientCert, c.ClientKey = "", ""
+	err = esdt.New(c).Run(tlsOp)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "certificate required")
+
+	c = config()
+	c.ClientKey = ""
+	assert.EqualError(t, esdt.New(c).Run(tlsOp), "Both a client certificate and client key are required")
+}
@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"context"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// Never responds until the request is cancelled
+type hungEs struct{}
+
+func (h *hungEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The disconnect is only noticed once the body has been read
+	ioutil.ReadAll(r.Body)
+	<-r.Context().Done()
+}
+
+func TestRunContext(t *testing.T) {
+	server := httptest.NewServer(&hungEs{})
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{
+		Conn: server.URL,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := e.RunContext(ctx, &esdt.Operation{Id: "context_operation", Method: "PUT", Uri: "test"})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	e = esdt.New(&esdt.Config{
+		Conn:    server.URL,
+		Timeout: 100 * time.Millisecond,
+	})
+
+	start = time.Now()
+	err = e.Run(&esdt.Operation{Id: "context_operation", Method: "PUT", Uri: "test"})
+	assert.Error(t, err)
+	assert.True(t, time.Since(start) < 5*time.Second)
+}
+
+// Accepts every request, taking the delay to respond to each one
+type slowEs struct {
+	stubEs
+	delay time.Duration
+}
+
+func (s *slowEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		time.Sleep(s.delay)
+	}
+	s.stubEs.ServeHTTP(w, r)
+}
+
+func TestOperationTimeoutOnlyBoundsRequest(t *testing.T) {
+	stub := &slowEs{delay: 150 * time.Millisecond}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{
+		Conn:             server.URL,
+		OperationTimeout: 200 * time.Millisecond,
+	})
+
+	err := e.Run(&esdt.Operation{Id: "slow_operation", Method: "PUT", Uri: "slow"})
+	assert.Nil(t, err)
+
+	var writes []string
+	for _, r := range stub.Requests() {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			writes = append(writes, r.Method+" "+r.URL.Path)
+		}
+	}
+	assert.Equal(t, []string{"PUT /slow", "POST /operations/_doc/slow_operation"}, writes)
+}
@@ -10,6 +10,9 @@ import (
 	"log"
 )
 
+// The location of the shared filesystem snapshot repository within the Elasticsearch container
+const snapshotDir = "/tmp/esdt-snapshots"
+
 func createEsDb() (pool *dockertest.Pool, resource *dockertest.Resource) {
 	pool, err := dockertest.NewPool("")
 	if err != nil {
@@ -20,6 +23,7 @@ func createEsDb() (pool *dockertest.Pool, resource *dockertest.Resource) {
 		&dockertest.RunOptions{
 			Repository: "elasticsearch",
 			Tag:        "6.4.1",
+			Env:        []string{"path.repo=" + snapshotDir},
 		})
 	if err != nil {
 		log.Fatalf("Could not start resource: %s", err)
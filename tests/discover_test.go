@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeOperations(t *testing.T, dir string, files map[string]string) {
+	for k, v := range files {
+		p := filepath.Join(dir, filepath.FromSlash(k))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(p), os.ModePerm))
+		assert.Nil(t, ioutil.WriteFile(p, []byte(v), os.ModePerm))
+	}
+}
+
+func TestRecursiveTargetDirs(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	root, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(root)
+
+	operation := "{ \"method\": \"PUT\", \"uri\": \"test\" }"
+	first := filepath.Join(root, "first")
+	second := filepath.Join(root, "second")
+	writeOperations(t, first, map[string]string{
+		"users/20181103000000_update_users.json":  operation,
+		"users/20181101000000_create_users.json":  operation,
+		"orders/20181102000000_create_orders.yml": "method: PUT\nuri: orders\n",
+		".hidden/20181101000000_ignored.json":     "{",
+	})
+	writeOperations(t, second, map[string]string{
+		"20181104000000_shared.json": operation,
+	})
+
+	e := esdt.New(&esdt.Config{Conn: server.URL, TargetDir: first + "," + second})
+	operations, err := e.LoadAll()
+	assert.Nil(t, err)
+
+	var ids []string
+	for _, v := range operations {
+		ids = append(ids, v.Id)
+	}
+	assert.Equal(t, []string{
+		"users/20181101000000_create_users",
+		"orders/20181102000000_create_orders",
+		"users/20181103000000_update_users",
+		"20181104000000_shared",
+	}, ids)
+
+	operation2, err := e.Load("20181102000000_create_orders")
+	assert.Nil(t, err)
+	assert.Equal(t, "orders/20181102000000_create_orders", operation2.Id)
+
+	assert.Nil(t, e.RunAll())
+	recorded := false
+	for _, r := range stub.Requests() {
+		if r.URL.EscapedPath() == "/operations/_doc/users%2F20181101000000_create_users" {
+			recorded = true
+		}
+	}
+	assert.True(t, recorded)
+
+	writeOperations(t, second, map[string]string{
+		"users/20181101000000_create_users.json": operation,
+	})
+	e = esdt.New(&esdt.Config{Conn: server.URL, TargetDirs: []string{first, second}})
+	_, err = e.LoadAll()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Duplicate operation id users/20181101000000_create_users")
+
+	issues, err := e.Validate()
+	assert.Nil(t, err)
+	var errs []*esdt.ValidationIssue
+	for _, v := range issues {
+		if !v.Warning {
+			errs = append(errs, v)
+		}
+	}
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// Responds to GET <indices>, GET _ingest/pipeline and GET _index_template with fixed state. A
+// cluster without index templates responds as Elasticsearch 6 does.
+type stateEs struct {
+	indices   string
+	pipelines string
+	templates string
+}
+
+func (s stateEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/_ingest/pipeline":
+		w.Write([]byte(s.pipelines))
+	case "/_index_template":
+		if s.templates == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{ "error": { "type": "invalid_index_name_exception", "reason": "Invalid index name [_index_template], must not start with '_'." }, "status": 400 }`))
+			return
+		}
+		w.Write([]byte(s.templates))
+	case "/orders,users":
+		w.Write([]byte(s.indices))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("{}"))
+	}
+}
+
+func TestDrift(t *testing.T) {
+	staging := httptest.NewServer(stateEs{
+		indices: `{
+			"users": { "aliases": {}, "mappings": { "properties": { "age": { "type": "integer" } } }, "settings": { "index.number_of_replicas": "1", "index.uuid": "a1" } },
+			"orders": { "aliases": {}, "mappings": {}, "settings": { "index.uuid": "b2" } }
+		}`,
+		pipelines: `{ "lowercase": { "processors": [ { "lowercase": { "field": "name" } } ] }, "unmanaged": { "processors": [] } }`,
+		templates: `{ "index_templates": [ { "name": "users", "index_template": { "index_patterns": ["users-*"] } } ] }`,
+	})
+	defer staging.Close()
+	prod := httptest.NewServer(stateEs{
+		indices:   `{ "users": { "aliases": {}, "mappings": { "properties": { "age": { "type": "long" } } }, "settings": { "index.number_of_replicas": "1", "index.uuid": "c3" } } }`,
+		pipelines: `{ "lowercase": { "processors": [ { "lowercase": { "field": "name" } } ] } }`,
+	})
+	defer prod.Close()
+
+	fsys := fstest.MapFS{
+		"es/config.yml": {Data: []byte("staging:\n  conn: " + staging.URL + "\nprod:\n  conn: " + prod.URL + "\n")},
+		"es/operations/20181101000000_create_users.json":     {Data: []byte(`{ "method": "PUT", "uri": "users" }`)},
+		"es/operations/20181102000000_create_orders.json":    {Data: []byte(`{ "method": "PUT", "uri": "orders" }`)},
+		"es/operations/20181103000000_create_lowercase.json": {Data: []byte(`{ "method": "PUT", "uri": "_ingest/pipeline/lowercase", "body": { "processors": [] } }`)},
+		"es/operations/20181104000000_create_template.json":  {Data: []byte(`{ "method": "PUT", "uri": "_index_template/users", "body": { "index_patterns": ["users-*"] } }`)},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, Env: "staging"})
+
+	items, err := e.Drift("prod")
+	assert.Nil(t, err)
+
+	var drift []string
+	for _, v := range items {
+		drift = append(drift, v.String())
+	}
+	assert.Equal(t, []string{
+		"index orders: exists != (missing)",
+		"index users: mappings.properties.age.type: integer != long",
+		"index_template users: exists != (missing)",
+	}, drift)
+
+	items, err = e.Drift("staging")
+	assert.Nil(t, err)
+	assert.Empty(t, items)
+
+	_, err = e.Drift("qa")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Environment qa is not in es/config.yml")
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"esdt/esdt"
+	"fmt"
 	"github.com/stretchr/testify/suite"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -83,6 +87,198 @@ func (ets *EsdtTestSuite) TestRollback() {
 	ets.EqualError(err, "elastic: Error 404 (Not Found)")
 }
 
+func (ets *EsdtTestSuite) TestRedo() {
+	e := esdt.New(&esdt.Config{
+		Conn: ets.url,
+	})
+
+	operation := &esdt.Operation{
+		Id:     "some_operation_3",
+		Method: "PUT",
+		Uri:    "test3",
+		Rollback: esdt.RollbackTemplate{
+			Uri:    "test3",
+			Method: "DELETE",
+		},
+	}
+
+	err := e.Run(operation)
+	ets.Nil(err)
+
+	err = e.Redo(operation)
+	ets.Nil(err)
+
+	ex, err := ets.client.IndexExists(operation.Uri).Do(context.Background())
+	ets.Nil(err)
+	ets.True(ex)
+
+	_, err = ets.client.Get().Id(operation.Id).Index("operations").Do(context.Background())
+	ets.Nil(err)
+
+	operation.Rollback = esdt.RollbackTemplate{}
+	err = e.Redo(operation)
+	ets.EqualError(err, esdt.RedoRollbackFailedMsg+": "+esdt.NoRollbackFieldErrorMsg)
+}
+
+func (ets *EsdtTestSuite) TestAutoRollback() {
+	e := esdt.New(&esdt.Config{
+		Conn: ets.url,
+	})
+
+	_, err := ets.client.IndexPutTemplate("auto_template").BodyString("{ \"index_patterns\": [\"before*\"] }").Do(context.Background())
+	ets.Nil(err)
+
+	operation := &esdt.Operation{
+		Id:     "some_operation_4",
+		Method: "PUT",
+		Uri:    "_template/auto_template",
+		Body: map[string]interface{}{
+			"index_patterns": []string{"after*"},
+		},
+		Rollback: esdt.RollbackTemplate{
+			Mode: esdt.RollbackModeAuto,
+		},
+	}
+
+	err = e.Run(operation)
+	ets.Nil(err)
+
+	err = e.Rollback(operation)
+	ets.Nil(err)
+
+	res, err := ets.client.IndexGetTemplate("auto_template").Do(context.Background())
+	ets.Nil(err)
+	ets.Equal([]string{"before*"}, res["auto_template"].IndexPatterns)
+
+	index := &esdt.Operation{
+		Id:     "some_operation_5",
+		Method: "PUT",
+		Uri:    "test5",
+		Rollback: esdt.RollbackTemplate{
+			Mode: esdt.RollbackModeAuto,
+		},
+	}
+
+	err = e.Run(index)
+	ets.Nil(err)
+
+	err = e.Rollback(index)
+	ets.Nil(err)
+
+	ex, err := ets.client.IndexExists(index.Uri).Do(context.Background())
+	ets.Nil(err)
+	ets.False(ex)
+}
+
+func (ets *EsdtTestSuite) TestRestore() {
+	_, err := ets.client.SnapshotCreateRepository("esdt_backup").Type("fs").Settings(map[string]interface{}{
+		"location": snapshotDir,
+	}).Do(context.Background())
+	ets.Nil(err)
+
+	_, err = ets.client.CreateIndex("test6").Do(context.Background())
+	ets.Nil(err)
+
+	e := esdt.New(&esdt.Config{
+		Conn:         ets.url,
+		SnapshotRepo: "esdt_backup",
+	})
+
+	operation := &esdt.Operation{
+		Id:     "some_operation_6",
+		Method: "DELETE",
+		Uri:    "test6",
+	}
+
+	err = e.Run(operation)
+	ets.Nil(err)
+
+	ex, err := ets.client.IndexExists("test6").Do(context.Background())
+	ets.Nil(err)
+	ets.False(ex)
+
+	err = e.Restore(operation.Id)
+	ets.Nil(err)
+
+	ex, err = ets.client.IndexExists("test6").Do(context.Background())
+	ets.Nil(err)
+	ets.True(ex)
+
+	_, err = ets.client.Get().Id(operation.Id).Index("operations").Do(context.Background())
+	ets.EqualError(err, "elastic: Error 404 (Not Found)")
+}
+
+func (ets *EsdtTestSuite) TestBaseline() {
+	dir, err := ioutil.TempDir("", "esdt")
+	ets.Nil(err)
+	defer os.RemoveAll(dir)
+
+	operation := "{ \"method\": \"PUT\", \"uri\": \"%s\", \"rollback\": { \"method\": \"DELETE\", \"uri\": \"%s\" } }"
+	ets.Nil(ioutil.WriteFile(filepath.Join(dir, "20181101000000_baseline_1.json"), []byte(fmt.Sprintf(operation, "baseline1", "baseline1")), os.ModePerm))
+	ets.Nil(ioutil.WriteFile(filepath.Join(dir, "20181102000000_baseline_2.json"), []byte(fmt.Sprintf(operation, "baseline2", "baseline2")), os.ModePerm))
+
+	e := esdt.New(&esdt.Config{
+		Conn:      ets.url,
+		TargetDir: dir,
+	})
+
+	err = e.Baseline("20181101000000_baseline_1")
+	ets.Nil(err)
+
+	ex, err := ets.client.IndexExists("baseline1").Do(context.Background())
+	ets.Nil(err)
+	ets.False(ex)
+
+	gr, err := ets.client.Get().Id("20181101000000_baseline_1").Index("operations").Do(context.Background())
+	if err != nil {
+		ets.FailNow(err.Error())
+	}
+	source := make(map[string]interface{})
+	json.Unmarshal(*gr.Source, &source)
+	ets.Equal(true, source["baseline"])
+
+	_, err = ets.client.Get().Id("20181102000000_baseline_2").Index("operations").Do(context.Background())
+	ets.EqualError(err, "elastic: Error 404 (Not Found)")
+
+	err = e.Baseline("20181103000000_missing")
+	ets.Error(err)
+}
+
+func (ets *EsdtTestSuite) TestMarkPending() {
+	operation := &esdt.Operation{
+		Id:     "some_operation_2",
+		Method: "PUT",
+		Uri:    "test2",
+		Rollback: esdt.RollbackTemplate{
+			Uri:    "test2",
+			Method: "DELETE",
+		},
+	}
+
+	e := esdt.New(&esdt.Config{
+		Conn: ets.url,
+	})
+	err := e.Run(operation)
+	ets.Nil(err)
+
+	protected := esdt.New(&esdt.Config{
+		Conn:      ets.url,
+		Protected: true,
+	})
+	err = protected.MarkPending(operation.Id, false)
+	ets.EqualError(err, esdt.ProtectedEnvErrorMsg)
+
+	err = protected.MarkPending(operation.Id, true)
+	ets.Nil(err)
+
+	ex, err := ets.client.IndexExists(operation.Uri).Do(context.Background())
+	ets.Nil(err)
+	ets.True(ex)
+
+	_, err = ets.client.Get().Id(operation.Id).Index("operations").Do(context.Background())
+	ets.EqualError(err, "elastic: Error 404 (Not Found)")
+}
+
 func TestEsdt(t *testing.T) {
 	suite.Run(t, new(EsdtTestSuite))
 }
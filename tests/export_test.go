@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Responds with the state of a small legacy cluster
+type legacyEs struct{}
+
+func (legacyEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/_index_template":
+		w.Write([]byte(`{ "index_templates": [
+			{ "name": "users", "index_template": { "index_patterns": ["users-*"], "template": { "settings": { "index": { "number_of_shards": "1" } } } } },
+			{ "name": "logs", "index_template": { "index_patterns": ["logs-*"], "_meta": { "managed": true } } }
+		] }`))
+	case "/_ingest/pipeline":
+		w.Write([]byte(`{ "lowercase": { "processors": [ { "lowercase": { "field": "name" } } ] } }`))
+	case "/*":
+		w.Write([]byte(`{
+			"users-1": {
+				"aliases": { "users": {} },
+				"mappings": { "properties": { "name": { "type": "text" } } },
+				"settings": {
+					"index.number_of_shards": "1",
+					"index.uuid": "x3ds9",
+					"index.creation_date": "1541030400000",
+					"index.provided_name": "users-1",
+					"index.version.created": "7100099"
+				}
+			},
+			".security": { "aliases": {}, "mappings": {}, "settings": {} },
+			"operations": { "aliases": {}, "mappings": { "properties": { "inserted_at": { "type": "date" } } }, "settings": {} }
+		}`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("{}"))
+	}
+}
+
+func TestExport(t *testing.T) {
+	server := httptest.NewServer(legacyEs{})
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{Conn: server.URL})
+
+	operations, err := e.Export("")
+	assert.Nil(t, err)
+
+	var ids []string
+	for _, v := range operations {
+		ids = append(ids, v.Id)
+	}
+	assert.Equal(t, []string{"create_index_template_users", "create_pipeline_lowercase", "create_index_users-1"}, ids)
+	// Exporting the operations index would derive a rollback which deletes every record
+	assert.NotContains(t, ids, "create_index_operations")
+
+	index := operations[2]
+	assert.Equal(t, "PUT", index.Method)
+	assert.Equal(t, "users-1", index.Uri)
+	assert.Equal(t, map[string]interface{}{"index.number_of_shards": "1"}, index.Body["settings"])
+	assert.Equal(t, map[string]interface{}{"users": map[string]interface{}{}}, index.Body["aliases"])
+	assert.Equal(t, esdt.RollbackTemplate{Method: "DELETE", Uri: "users-1"}, index.Rollback)
+
+	dir, err := ioutil.TempDir("", "esdt-export")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, filename := range []string{"20181101000000_create_index_users-1.json", "20181101000000_create_index_users-1.yml"} {
+		content, err := esdt.EncodeOperation(filename, index)
+		assert.Nil(t, err)
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, filename), content, 0644))
+
+		loaded, err := esdt.New(&esdt.Config{TargetDir: dir}).Load(filename)
+		assert.Nil(t, err)
+		assert.Equal(t, index.Body, loaded.Body)
+		assert.Equal(t, index.Rollback.Uri, loaded.Rollback.Uri)
+	}
+}
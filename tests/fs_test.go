@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOperationsFS(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"es/config.yml": {Data: []byte("dev:\n  conn: " + server.URL + "\n")},
+		"es/operations/20181101000000_create_embedded.json":   {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"embedded\" }")},
+		"es/operations/users/20181102000000_create_users.yml": {Data: []byte("method: PUT\nuri: users\n")},
+	}
+
+	e := esdt.New(&esdt.Config{
+		FS:         fsys,
+		TargetDir:  "es/operations",
+		ConfigFile: "es/config.yml",
+		Env:        "dev",
+	})
+	assert.Equal(t, server.URL, e.GetConfig().Conn)
+
+	operation, err := e.Load("20181102000000_create_users")
+	assert.Nil(t, err)
+	assert.Equal(t, "users/20181102000000_create_users", operation.Id)
+
+	assert.Nil(t, e.RunAll())
+
+	var paths []string
+	for _, r := range stub.Requests() {
+		if r.Method == "PUT" {
+			paths = append(paths, r.URL.Path)
+		}
+	}
+	assert.Equal(t, []string{"/embedded", "/users"}, paths)
+}
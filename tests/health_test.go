@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Reports a red cluster for the first red health checks, then a yellow one
+type startingEs struct {
+	stubEs
+	red    int32
+	checks int32
+}
+
+func (s *startingEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/_cluster/health" {
+		status := "yellow"
+		if atomic.AddInt32(&s.checks, 1) <= s.red {
+			status = "red"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{ \"status\": \"" + status + "\" }"))
+		return
+	}
+	s.stubEs.ServeHTTP(w, r)
+}
+
+func TestWaitForCluster(t *testing.T) {
+	starting := &startingEs{red: 1}
+	server := httptest.NewServer(starting)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{
+		Conn:           server.URL,
+		WaitForCluster: 10 * time.Second,
+	})
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "wait_operation", Method: "PUT", Uri: "test"}))
+	assert.Equal(t, int32(2), starting.checks)
+
+	e = esdt.New(&esdt.Config{
+		Conn:           server.URL,
+		WaitForCluster: 1500 * time.Millisecond,
+		WaitForStatus:  "green",
+	})
+	err := e.Run(&esdt.Operation{Id: "wait_operation", Method: "PUT", Uri: "test"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "not ready")
+
+	e = esdt.New(&esdt.Config{
+		Conn:           "http://127.0.0.1:1",
+		WaitForCluster: 100 * time.Millisecond,
+	})
+	assert.Error(t, e.Run(&esdt.Operation{Id: "wait_operation", Method: "PUT", Uri: "test"}))
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func TestIncludes(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_create_users.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"users\", \"body\": { \"mappings\": { \"$include\": \"mappings/user.yml\" } } }")},
+		"ops/20181102000000_store_script.yml":  {Data: []byte("method: PUT\nuri: _scripts/migrate\nbody:\n  script:\n    lang: painless\n    source: { $file: scripts/migrate.painless }\n")},
+		"ops/mappings/user.yml":                {Data: []byte("properties:\n  name: { $include: mappings/keyword.json }\n")},
+		"ops/mappings/keyword.json":            {Data: []byte("{ \"type\": \"keyword\" }")},
+		"ops/scripts/migrate.painless":         {Data: []byte("ctx._source.rank *= 2;")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL})
+
+	operation, err := e.Load("20181101000000_create_users")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"mappings": map[string]interface{}{
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "keyword"},
+			},
+		},
+	}, operation.Body)
+
+	operation, err = e.Load("20181102000000_store_script")
+	assert.Nil(t, err)
+	assert.Equal(t, "ctx._source.rank *= 2;", operation.Body["script"].(map[string]interface{})["source"])
+
+	operations, err := e.LoadAll()
+	assert.Nil(t, err)
+	assert.Len(t, operations, 2)
+
+	issues, err := e.Validate()
+	assert.Nil(t, err)
+	for _, v := range issues {
+		assert.True(t, v.Warning, v.Error())
+	}
+
+	assert.Nil(t, e.RunAll())
+	var paths []string
+	for _, r := range stub.Requests() {
+		if r.Method == "PUT" {
+			paths = append(paths, r.URL.Path)
+		}
+	}
+	assert.Equal(t, []string{"/users", "/_scripts/migrate"}, paths)
+}
+
+func TestIncludeCycle(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ops/20181101000000_create_users.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"users\", \"body\": { \"$include\": \"a.json\" } }")},
+		"ops/a.json":                           {Data: []byte("{ \"settings\": { \"$include\": \"b.json\" } }")},
+		"ops/b.json":                           {Data: []byte("{ \"index\": { \"$include\": \"a.json\" } }")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: "http://localhost:9200"})
+
+	_, err := e.Load("20181101000000_create_users")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Include cycle a.json -> b.json -> a.json")
+}
+
+func TestIncludeOutsideTargetDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"ops/20181101000000_create_users.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"users\", \"body\": { \"mappings\": { \"$include\": \"mappings/../../secrets.json\" } } }")},
+		"ops/20181102000000_store_script.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"_scripts/s\", \"body\": { \"script\": { \"source\": { \"$file\": \"/../secrets.json\" } } } }")},
+		"secrets.json":                         {Data: []byte("{ \"password\": \"hunter2\" }")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops"})
+
+	_, err := e.Load("20181101000000_create_users")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Included file mappings/../../secrets.json is outside of ops")
+
+	_, err = e.Load("20181102000000_store_script")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Included file /../secrets.json is outside of ops")
+}
+
+func TestChecksumEmptyBody(t *testing.T) {
+	stub := &recordEs{records: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_create_users.json": {Data: []byte("{ \"method\": \"PUT\", \"uri\": \"users\", \"rollback\": { \"method\": \"DELETE\", \"uri\": \"users\" } }")},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL})
+	assert.Nil(t, e.RunAll())
+
+	// The same operation run with an empty body is recorded with the same checksum
+	assert.Nil(t, e.Run(&esdt.Operation{
+		Id:       "create_users_again",
+		Method:   "PUT",
+		Uri:      "users",
+		Body:     map[string]interface{}{},
+		Rollback: esdt.RollbackTemplate{Method: "DELETE", Uri: "users", Body: map[string]interface{}{}},
+	}))
+
+	checksum := stub.records["20181101000000_create_users"]["checksum"]
+	assert.NotEmpty(t, checksum)
+	assert.Equal(t, checksum, stub.records["create_users_again"]["checksum"])
+}
@@ -0,0 +1,47 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRunAllInvalidFiles(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"20181101000000_valid.json":  "{ \"method\": \"PUT\", \"uri\": \"valid\" }",
+		"20181102000000_broken.json": "{\n  \"method\": \"PUT\",\n  \"uri\" \"broken\"\n}",
+		"notes.txt":                  "not an operation",
+		"README.md":                  "# Operations",
+		".gitkeep":                   "",
+	}
+	for k, v := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, k), []byte(v), os.ModePerm))
+	}
+
+	e := esdt.New(&esdt.Config{Conn: server.URL, TargetDir: dir})
+	err = e.RunAll()
+	assert.Error(t, err)
+	loadErrors, ok := err.(esdt.LoadErrors)
+	assert.True(t, ok)
+	assert.Len(t, loadErrors, 2)
+	assert.Contains(t, err.Error(), filepath.Join(dir, "20181102000000_broken.json"))
+	assert.Contains(t, err.Error(), "line 3, column 9")
+	assert.Contains(t, err.Error(), filepath.Join(dir, "notes.txt"))
+	assert.Empty(t, stub.Requests())
+
+	e = esdt.New(&esdt.Config{Conn: server.URL, TargetDir: dir, Exclude: []string{"*.txt"}, SkipInvalid: true})
+	assert.Nil(t, e.RunAll())
+	assert.NotEmpty(t, stub.Requests())
+}
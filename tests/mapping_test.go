@@ -0,0 +1,108 @@
+package tests
+
+import (
+	"encoding/json"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func parseMapping(t *testing.T, s string) map[string]interface{} {
+	var m map[string]interface{}
+	assert.Nil(t, json.Unmarshal([]byte(s), &m))
+	return m
+}
+
+func TestDiffMappings(t *testing.T) {
+	current := parseMapping(t, `{ "properties": {
+		"name": { "type": "text", "analyzer": "english", "fields": { "raw": { "type": "keyword" } } },
+		"age": { "type": "integer" },
+		"address": { "properties": { "city": { "type": "keyword", "ignore_above": 256 } } },
+		"tags": { "type": "keyword" }
+	} }`)
+	proposed := parseMapping(t, `{ "properties": {
+		"name": { "type": "text", "analyzer": "standard", "fields": { "raw": { "type": "keyword" } } },
+		"age": { "type": "long" },
+		"address": { "properties": { "city": { "type": "keyword", "ignore_above": 512 }, "zip": { "type": "keyword" } } }
+	} }`)
+
+	var breaking []string
+	var other []string
+	for _, v := range esdt.DiffMappings(current, proposed) {
+		if v.Breaking {
+			breaking = append(breaking, v.Field+" "+v.Kind)
+		} else {
+			other = append(other, v.Field+" "+v.Kind)
+		}
+	}
+
+	assert.Equal(t, []string{"age changed", "name changed", "tags removed"}, breaking)
+	assert.Equal(t, []string{"address.city changed", "address.zip added"}, other)
+}
+
+// Responds to GET <index>/_mapping with a fixed mapping and to everything else as the stub does
+type mappingEs struct {
+	stubEs
+	mapping string
+}
+
+func (s *mappingEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "GET" && r.URL.Path == "/users/_mapping" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(s.mapping))
+		return
+	}
+	s.stubEs.ServeHTTP(w, r)
+}
+
+func TestValidateMappings(t *testing.T) {
+	stub := &mappingEs{mapping: `{ "users-1": { "mappings": { "properties": {
+		"name": { "type": "text" },
+		"email": { "type": "keyword" }
+	} } } }`}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_add_age.json":       {Data: []byte(`{ "method": "PUT", "uri": "users/_mapping", "body": { "properties": { "age": { "type": "integer" } } } }`)},
+		"ops/20181102000000_retype_email.json":  {Data: []byte(`{ "method": "PUT", "uri": "users/_mapping", "body": { "properties": { "email": { "type": "text" } } } }`)},
+		"ops/20181103000000_create_orders.json": {Data: []byte(`{ "method": "PUT", "uri": "orders" }`)},
+		"mappings/users.json":                   {Data: []byte(`{ "mappings": { "properties": { "name": { "type": "text" } } } }`)},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL})
+
+	issues, err := e.ValidateMappings()
+	assert.Nil(t, err)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, "20181102000000_retype_email", issues[0].File)
+	assert.Contains(t, issues[0].Message, "users-1")
+	assert.Contains(t, issues[0].Message, "email: Type changed from keyword to text")
+
+	diffs, err := e.DiffMapping("users", "20181101000000_add_age")
+	assert.Nil(t, err)
+	assert.Len(t, diffs["users-1"], 1)
+	assert.Equal(t, esdt.MappingFieldAdded, diffs["users-1"][0].Kind)
+
+	diffs, err = e.DiffMapping("users", "mappings/users.json")
+	assert.Nil(t, err)
+	assert.Len(t, diffs["users-1"], 1)
+	assert.Equal(t, "email", diffs["users-1"][0].Field)
+	assert.Equal(t, esdt.MappingFieldRemoved, diffs["users-1"][0].Kind)
+
+	_, err = e.DiffMapping("users", "20181103000000_create_orders")
+	assert.NotNil(t, err)
+
+	// The parse error of a matching operation is returned, rather than looking for a mapping file
+	fsys["ops/20181104000000_broken.json"] = &fstest.MapFile{Data: []byte("{\n  \"method\": \"PUT\",\n  \"uri\" \"users/_mapping\"\n}")}
+	_, err = e.DiffMapping("users", "20181104000000_broken")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not parse file ops/20181104000000_broken.json")
+
+	_, err = e.DiffMapping("users", "mappings/orders.json")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Could not find a mapping or operation mappings/orders.json")
+}
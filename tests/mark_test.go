@@ -0,0 +1,111 @@
+package tests
+
+import (
+	"encoding/json"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+)
+
+// Keeps the operations records it is sent, so that they can be read and deleted again
+type recordEs struct {
+	mu      sync.Mutex
+	records map[string]map[string]interface{}
+	writes  []string
+}
+
+func (s *recordEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.HasPrefix(r.URL.Path, "/operations/_doc/") {
+		w.Write([]byte("{}"))
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/operations/_doc/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method != "GET" {
+		s.writes = append(s.writes, r.Method+" "+id)
+	}
+
+	_, found := s.records[id]
+	switch r.Method {
+	case "GET":
+		res, _ := json.Marshal(map[string]interface{}{"found": found, "_source": s.records[id]})
+		w.Write(res)
+	case "POST":
+		var record map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&record)
+		s.records[id] = record
+		w.Write([]byte("{ \"result\": \"created\" }"))
+	case "DELETE":
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("{ \"result\": \"not_found\" }"))
+			return
+		}
+		delete(s.records, id)
+		w.Write([]byte("{ \"result\": \"deleted\" }"))
+	}
+}
+
+func TestMarkAppliedAndPending(t *testing.T) {
+	stub := &recordEs{records: make(map[string]map[string]interface{})}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_create_users.json": {Data: []byte(`{ "method": "PUT", "uri": "users" }`)},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL})
+
+	assert.Nil(t, e.MarkApplied("20181101000000_create_users", false))
+	assert.Equal(t, []string{"POST 20181101000000_create_users"}, stub.writes)
+	assert.Equal(t, true, stub.records["20181101000000_create_users"]["manual"])
+
+	err := e.MarkApplied("20181101000000_create_users", false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Already ran")
+
+	assert.Nil(t, e.MarkPending("20181101000000_create_users", false))
+	assert.Equal(t, []string{"POST 20181101000000_create_users", "DELETE 20181101000000_create_users"}, stub.writes)
+	assert.Empty(t, stub.records)
+
+	err = e.MarkPending("20181101000000_create_users", false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "20181101000000_create_users has not been run")
+}
+
+func TestMarkProtected(t *testing.T) {
+	stub := &recordEs{records: map[string]map[string]interface{}{
+		"20181101000000_create_users": {"manual": true},
+	}}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	fsys := fstest.MapFS{
+		"ops/20181101000000_create_users.json":  {Data: []byte(`{ "method": "PUT", "uri": "users" }`)},
+		"ops/20181102000000_create_orders.json": {Data: []byte(`{ "method": "PUT", "uri": "orders" }`)},
+	}
+
+	e := esdt.New(&esdt.Config{FS: fsys, TargetDir: "ops", Conn: server.URL, Protected: true})
+
+	err := e.MarkApplied("20181102000000_create_orders", false)
+	assert.NotNil(t, err)
+	assert.Equal(t, esdt.ProtectedEnvErrorMsg, err.Error())
+
+	err = e.MarkPending("20181101000000_create_users", false)
+	assert.NotNil(t, err)
+	assert.Equal(t, esdt.ProtectedEnvErrorMsg, err.Error())
+	assert.Empty(t, stub.writes)
+
+	assert.Nil(t, e.MarkApplied("20181102000000_create_orders", true))
+	assert.Nil(t, e.MarkPending("20181101000000_create_users", true))
+	assert.Equal(t, []string{"POST 20181102000000_create_orders", "DELETE 20181101000000_create_users"}, stub.writes)
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	// Requests through a proxy are sent with the full URL, so the stub serves them as is
+	stub := &stubEs{}
+	proxy := httptest.NewServer(stub)
+	defer proxy.Close()
+
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.yml")
+	config := fmt.Sprintf("dev:\n  conn: http://es.internal:9200\n  proxy: %s\n  headers:\n    X-Tenant: acme\n", proxy.URL)
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte(config), os.ModePerm))
+
+	e := esdt.New(&esdt.Config{
+		ConfigFile: configFile,
+		Env:        "dev",
+		Headers:    map[string]string{"X-Route": "blue"},
+	})
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "proxy_operation", Method: "PUT", Uri: "test"}))
+
+	assert.NotEmpty(t, stub.Requests())
+	for _, r := range stub.Requests() {
+		assert.Equal(t, "es.internal:9200", r.Host)
+		assert.Equal(t, "acme", r.Header.Get("X-Tenant"))
+		assert.Equal(t, "blue", r.Header.Get("X-Route"))
+	}
+
+	os.Setenv("NO_PROXY", "localhost,.internal")
+	defer os.Unsetenv("NO_PROXY")
+
+	count := len(stub.Requests())
+	e = esdt.New(&esdt.Config{
+		ConfigFile:  configFile,
+		Env:         "dev",
+		MaxAttempts: 1,
+	})
+	assert.Error(t, e.Run(&esdt.Operation{Id: "proxy_operation", Method: "PUT", Uri: "test"}))
+	assert.Equal(t, count, len(stub.Requests()))
+}
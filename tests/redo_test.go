@@ -0,0 +1,29 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRedoNotRun(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{Conn: server.URL})
+	err := e.Redo(&esdt.Operation{
+		Id:       "create_users",
+		Method:   "PUT",
+		Uri:      "users",
+		Rollback: esdt.RollbackTemplate{Method: "DELETE", Uri: "users"},
+	})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "create_users has not been run")
+
+	// Neither the rollback nor the operation is sent
+	for _, r := range stub.Requests() {
+		assert.Equal(t, "GET", r.Method, r.URL.Path)
+	}
+}
@@ -0,0 +1,67 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Responds with 503 to the first failures requests for the given method
+type flakyEs struct {
+	stubEs
+	method   string
+	failures int32
+	count    int32
+}
+
+func (f *flakyEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == f.method && atomic.AddInt32(&f.count, 1) <= f.failures {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	f.stubEs.ServeHTTP(w, r)
+}
+
+func TestFailover(t *testing.T) {
+	server := httptest.NewServer(&stubEs{})
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{
+		Hosts:        []string{"http://127.0.0.1:1", server.URL},
+		MaxAttempts:  2,
+		RetryBackoff: time.Millisecond,
+	})
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, e.Run(&esdt.Operation{Id: "failover_operation", Method: "POST", Uri: "test/_doc"}))
+	}
+}
+
+func TestRetry(t *testing.T) {
+	flaky := &flakyEs{method: "PUT", failures: 2}
+	server := httptest.NewServer(flaky)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{
+		Conn:         server.URL,
+		RetryBackoff: time.Millisecond,
+	})
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "retry_operation", Method: "PUT", Uri: "test"}))
+	assert.Equal(t, int32(3), flaky.count)
+
+	flaky = &flakyEs{method: "POST", failures: 1}
+	server = httptest.NewServer(flaky)
+	defer server.Close()
+
+	e = esdt.New(&esdt.Config{
+		Conn:         server.URL,
+		RetryBackoff: time.Millisecond,
+	})
+	assert.Error(t, e.Run(&esdt.Operation{Id: "retry_operation", Method: "POST", Uri: "test/_doc"}))
+	assert.Equal(t, int32(1), flaky.count)
+
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "retry_operation", Method: "POST", Uri: "test/_doc/1", RetrySafe: true}))
+}
@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"esdt/esdt"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	awsAccessKeyId     = "AKIDEXAMPLE"
+	awsSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+)
+
+// Wraps the stub Elasticsearch and rejects any request whose SigV4 signature does not
+// verify against the example credentials
+type sigV4Verifier struct {
+	stubEs
+	region  string
+	service string
+}
+
+func (v *sigV4Verifier) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	expected := v.signature(r, body)
+	if expected == "" || !strings.HasSuffix(r.Header.Get("Authorization"), "Signature="+expected) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte("{ \"message\": \"The request signature we calculated does not match the signature you provided\" }"))
+		return
+	}
+	v.stubEs.ServeHTTP(w, r)
+}
+
+func (v *sigV4Verifier) signature(r *http.Request, body []byte) string {
+	auth := r.Header.Get("Authorization")
+	parts := strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ")
+	if len(parts) != 3 {
+		return ""
+	}
+	scope := strings.TrimPrefix(parts[0], "Credential="+awsAccessKeyId+"/")
+	signedHeaders := strings.TrimPrefix(parts[1], "SignedHeaders=")
+	amzDate := r.Header.Get("X-Amz-Date")
+	date := strings.Split(scope, "/")[0]
+	if scope != fmt.Sprintf("%s/%s/%s/aws4_request", date, v.region, v.service) || !strings.HasPrefix(amzDate, date) {
+		return ""
+	}
+
+	var headers []string
+	for _, h := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(h)
+		if h == "host" {
+			value = r.Host
+		}
+		headers = append(headers, h+":"+value+"\n")
+	}
+
+	query := r.URL.Query()
+	var pairs []string
+	for k, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, strings.Replace(url.QueryEscape(k), "+", "%20", -1)+"="+strings.Replace(url.QueryEscape(value), "+", "%20", -1))
+		}
+	}
+	sort.Strings(pairs)
+
+	// Every service but S3 encodes the already escaped path once more, so %2F is signed as %252F
+	path := awsUriEncode(r.URL.EscapedPath())
+	if path == "" {
+		path = "/"
+	}
+	payload := sha256.Sum256(body)
+	canonical := strings.Join([]string{r.Method, path, strings.Join(pairs, "&"), strings.Join(headers, ""), signedHeaders, hex.EncodeToString(payload[:])}, "\n")
+	hashed := sha256.Sum256([]byte(canonical))
+
+	key := []byte("AWS4" + awsSecretAccessKey)
+	for _, s := range []string{date, v.region, v.service, "aws4_request"} {
+		key = hmacSum(key, s)
+	}
+	return hex.EncodeToString(hmacSum(key, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+hex.EncodeToString(hashed[:])))
+}
+
+// Percent-encodes every byte but the unreserved characters and slashes, as in the AWS docs
+func awsUriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSum(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func TestSigV4(t *testing.T) {
+	verifier := &sigV4Verifier{region: "eu-west-1", service: "es"}
+	server := httptest.NewServer(verifier)
+	defer server.Close()
+
+	os.Setenv("AWS_ACCESS_KEY_ID", awsAccessKeyId)
+	os.Setenv("AWS_SECRET_ACCESS_KEY", awsSecretAccessKey)
+	defer os.Unsetenv("AWS_ACCESS_KEY_ID")
+	defer os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+
+	e := esdt.New(&esdt.Config{
+		Conn:      server.URL,
+		AuthMode:  esdt.AuthModeAwsSigV4,
+		AwsRegion: "eu-west-1",
+	})
+	assert.Nil(t, e.Run(&esdt.Operation{
+		Id:     "sigv4_operation",
+		Method: "PUT",
+		Uri:    "test",
+		Body:   map[string]interface{}{"settings": map[string]interface{}{"number_of_shards": 1}},
+	}))
+	assert.NotEmpty(t, verifier.Requests())
+
+	// The record of an id with a slash is written to operations/_doc/users%2Fcreate
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "users/create", Method: "PUT", Uri: "test%20index"}))
+	assert.NotNil(t, lastRequest(&verifier.stubEs, "PUT", "/test index"))
+	assert.NotNil(t, lastRequest(&verifier.stubEs, "POST", "/operations/_doc/users/create"))
+
+	e = esdt.New(&esdt.Config{
+		Conn:      server.URL,
+		AuthMode:  esdt.AuthModeAwsSigV4,
+		AwsRegion: "us-east-1",
+	})
+	assert.Error(t, e.Run(&esdt.Operation{Id: "sigv4_operation", Method: "PUT", Uri: "test"}))
+}
+
+// Signs the requests of the AWS Signature Version 4 test suite and compares them with its
+// published signatures, rather than with the verifier, which computes the signature the same way
+func TestSigV4KnownAnswers(t *testing.T) {
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	cases := map[string]struct {
+		url       string
+		signature string
+	}{
+		"get-vanilla":                      {"https://example.amazonaws.com/", "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"},
+		"get-vanilla-query-order-key-case": {"https://example.amazonaws.com/?Param2=value2&Param1=value1", "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500"},
+		"get-vanilla-utf8-query":           {"https://example.amazonaws.com/?%E1%88%B4=bar", "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04"},
+		"get-unreserved":                   {"https://example.amazonaws.com/-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz", "07ef7494c76fa4850883e2b006601f940f8a34d404d0cfa977f52a65bbf5f24f"},
+		// The example in the AWS docs, whose canonical URI is /documents%2520and%2520settings/
+		"double-encoded-path": {"https://example.amazonaws.com/documents%20and%20settings/", "23c9727f014f850a592311a0323b422f9c1e3ad2d406c610f00d64ab3272c75a"},
+	}
+
+	for name, c := range cases {
+		r, err := http.NewRequest("GET", c.url, nil)
+		assert.Nil(t, err)
+		esdt.SignAwsSigV4(r, nil, awsAccessKeyId, awsSecretAccessKey, "us-east-1", "service", now)
+
+		assert.Equal(t, "20150830T123600Z", r.Header.Get("X-Amz-Date"), name)
+		assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature="+c.signature, r.Header.Get("Authorization"), name)
+	}
+}
@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"encoding/json"
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Snapshots the indices which exist, keeps the operations records it is sent and records
+// the other requests it receives
+type snapshotEs struct {
+	recordEs
+	existing    map[string]bool
+	failRestore bool
+	snapshots   []map[string]interface{}
+	requests    []string
+}
+
+func (s *snapshotEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/operations/_doc/") {
+		s.recordEs.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == "HEAD" && !strings.HasPrefix(r.URL.Path, "/_") && r.URL.Path != "/operations":
+		if !s.existing[strings.TrimPrefix(r.URL.Path, "/")] {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/_snapshot/"):
+		s.snapshots = append(s.snapshots, body)
+		indices := []string{}
+		requested, _ := body["indices"].(string)
+		for _, v := range strings.Split(requested, ",") {
+			if s.existing[v] {
+				indices = append(indices, v)
+			}
+		}
+		res, _ := json.Marshal(map[string]interface{}{"snapshot": map[string]interface{}{"state": "SUCCESS", "indices": indices}})
+		w.Write(res)
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/_snapshot/"):
+		w.Write([]byte("{ \"snapshots\": [ { \"state\": \"SUCCESS\" } ] }"))
+	case strings.HasSuffix(r.URL.Path, "/_restore") && s.failRestore:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("{ \"error\": \"restore failed\" }"))
+	default:
+		w.Write([]byte("{}"))
+	}
+}
+
+func newSnapshotEs(existing ...string) *snapshotEs {
+	s := &snapshotEs{recordEs: recordEs{records: make(map[string]map[string]interface{})}, existing: make(map[string]bool)}
+	for _, v := range existing {
+		s.existing[v] = true
+	}
+	return s
+}
+
+func TestSnapshotAffectedIndices(t *testing.T) {
+	stub := newSnapshotEs("users-1", "users-2", "orders")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{Conn: server.URL, SnapshotRepo: "backups"})
+
+	assert.Nil(t, e.Run(&esdt.Operation{
+		Id:     "reindex_users",
+		Method: "POST",
+		Uri:    "_reindex",
+		Body: map[string]interface{}{
+			"source": map[string]interface{}{"index": "users-1"},
+			"dest":   map[string]interface{}{"index": "users-2"},
+		},
+	}))
+	assert.Nil(t, e.Run(&esdt.Operation{
+		Id:     "move_alias",
+		Method: "POST",
+		Uri:    "_aliases",
+		Body: map[string]interface{}{
+			"actions": []interface{}{
+				map[string]interface{}{"remove": map[string]interface{}{"index": "users-1", "alias": "users"}},
+				map[string]interface{}{"add": map[string]interface{}{"index": "users-2", "alias": "users"}},
+			},
+		},
+	}))
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "update_users", Method: "POST", Uri: "users-2/_update_by_query"}))
+
+	if assert.Len(t, stub.snapshots, 3) {
+		assert.Equal(t, "users-2", stub.snapshots[0]["indices"])
+		assert.Equal(t, "users-1,users-2", stub.snapshots[1]["indices"])
+		assert.Equal(t, "users-2", stub.snapshots[2]["indices"])
+	}
+	assert.Equal(t, []interface{}{"users-2"}, stub.records["reindex_users"]["snapshot_indices"])
+	assert.Equal(t, []interface{}{"users-1", "users-2"}, stub.records["move_alias"]["snapshot_indices"])
+
+	// Operations which do not change an index are not snapshotted
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "cluster_settings", Method: "PUT", Uri: "_cluster/settings"}))
+	assert.Len(t, stub.snapshots, 3)
+
+	// Nor is the whole cluster snapshotted when the indices cannot be told
+	err := e.Run(&esdt.Operation{Id: "bulk_users", Method: "POST", Uri: "_bulk"})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "Cannot tell which indices bulk_users changes, list them in snapshot_indices")
+	assert.Len(t, stub.snapshots, 3)
+
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "bulk_orders", Method: "POST", Uri: "_bulk", SnapshotIndices: []string{"orders"}}))
+	if assert.Len(t, stub.snapshots, 4) {
+		assert.Equal(t, "orders", stub.snapshots[3]["indices"])
+	}
+}
+
+func TestRestoreCreatedIndex(t *testing.T) {
+	stub := newSnapshotEs()
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{Conn: server.URL, SnapshotRepo: "backups"})
+
+	// The index does not exist yet, so it is not in the snapshot and is deleted to restore
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "create_users", Method: "PUT", Uri: "users"}))
+	assert.Nil(t, stub.records["create_users"]["snapshot_indices"])
+	assert.Equal(t, []interface{}{"users"}, stub.records["create_users"]["created_indices"])
+
+	stub.requests = nil
+	assert.Nil(t, e.Restore("create_users"))
+	assert.Contains(t, stub.requests, "DELETE /users")
+	for _, v := range stub.requests {
+		assert.NotContains(t, v, "_close")
+		assert.NotContains(t, v, "_restore")
+	}
+	assert.Empty(t, stub.records)
+}
+
+func TestRestoreFailureReopensIndices(t *testing.T) {
+	stub := newSnapshotEs("orders")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{Conn: server.URL, SnapshotRepo: "backups"})
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "delete_orders", Method: "DELETE", Uri: "orders"}))
+
+	stub.failRestore = true
+	stub.requests = nil
+	assert.NotNil(t, e.Restore("delete_orders"))
+	assert.Equal(t, []string{"GET /_snapshot/backups/" + stub.records["delete_orders"]["snapshot"].(string), "POST /orders/_close", "POST /_snapshot/backups/" + stub.records["delete_orders"]["snapshot"].(string) + "/_restore", "POST /orders/_open"}, stub.requests)
+	assert.NotEmpty(t, stub.records)
+
+	stub.failRestore = false
+	assert.Nil(t, e.Restore("delete_orders"))
+	assert.Empty(t, stub.records)
+}
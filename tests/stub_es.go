@@ -0,0 +1,33 @@
+package tests
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// A minimal stand-in for Elasticsearch which accepts every operation and records the
+// requests it receives
+type stubEs struct {
+	mu       sync.Mutex
+	requests []*http.Request
+}
+
+func (s *stubEs) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/operations/_doc/") {
+		w.Write([]byte("{ \"found\": false }"))
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+func (s *stubEs) Requests() []*http.Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
@@ -0,0 +1,49 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// Counts the requests passing through it, like an instrumented transport would
+type countingTransport struct {
+	count int32
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.count, 1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestCustomTransport(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	transport := &countingTransport{}
+	e := esdt.New(&esdt.Config{
+		Conn:       server.URL,
+		HttpClient: &http.Client{Transport: transport},
+		Headers:    map[string]string{"X-Request-Source": "esdt"},
+	})
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "transport_operation", Method: "PUT", Uri: "test"}))
+	assert.Equal(t, int32(len(stub.Requests())), transport.count)
+	for _, r := range stub.Requests() {
+		assert.Equal(t, "esdt", r.Header.Get("X-Request-Source"))
+	}
+
+	transport = &countingTransport{}
+	e = esdt.New(&esdt.Config{
+		Conn:      server.URL,
+		Transport: transport,
+		Headers:   map[string]string{"Authorization": "ignored"},
+		ApiKey:    "ZW5jb2RlZA==",
+	})
+	assert.Nil(t, e.Run(&esdt.Operation{Id: "transport_operation", Method: "PUT", Uri: "test"}))
+	assert.NotZero(t, transport.count)
+	assert.Equal(t, "ApiKey ZW5jb2RlZA==", stub.Requests()[len(stub.Requests())-1].Header.Get("Authorization"))
+}
@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func lastRequest(stub *stubEs, method string, prefix string) *http.Request {
+	var last *http.Request
+	for _, r := range stub.Requests() {
+		if r.Method == method && strings.HasPrefix(r.URL.Path, prefix) {
+			last = r
+		}
+	}
+	return last
+}
+
+func TestOperationParamsAndHeaders(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	e := esdt.New(&esdt.Config{Conn: server.URL + "/es/"})
+	operation := &esdt.Operation{
+		Id:      "params_operation",
+		Method:  "PUT",
+		Uri:     "logs%2F2024/_doc/a%20b?refresh=false&routing=1",
+		Params:  map[string]interface{}{"refresh": "true", "wait_for_active_shards": "2"},
+		Headers: map[string]string{"X-Opaque-Id": "params_operation"},
+		Rollback: esdt.RollbackTemplate{
+			Method:  "DELETE",
+			Uri:     "logs%2F2024",
+			Params:  map[string]interface{}{"ignore_unavailable": "true"},
+			Headers: map[string]string{"X-Opaque-Id": "params_rollback"},
+		},
+	}
+	assert.Nil(t, e.Run(operation))
+
+	r := lastRequest(stub, "PUT", "/es/logs")
+	assert.Equal(t, "/es/logs%2F2024/_doc/a%20b", r.URL.EscapedPath())
+	assert.Equal(t, "true", r.URL.Query().Get("refresh"))
+	assert.Equal(t, "1", r.URL.Query().Get("routing"))
+	assert.Equal(t, "2", r.URL.Query().Get("wait_for_active_shards"))
+	assert.Equal(t, "params_operation", r.Header.Get("X-Opaque-Id"))
+
+	// The stub does not report the operation record as deleted, but the rollback is still sent
+	e.Rollback(operation)
+
+	r = lastRequest(stub, "DELETE", "/es/logs")
+	assert.Equal(t, "/es/logs%2F2024", r.URL.EscapedPath())
+	assert.Equal(t, "ignore_unavailable=true", r.URL.RawQuery)
+	assert.Equal(t, "params_rollback", r.Header.Get("X-Opaque-Id"))
+}
+
+func TestOperationParamsTypes(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	operation := `{
+		"method": "POST",
+		"uri": "users/_update_by_query",
+		"params": { "refresh": true, "wait_for_active_shards": 2, "requests_per_second": 1000000, "conflicts": "proceed" },
+		"rollback": { "method": "POST", "uri": "users/_refresh", "params": { "ignore_unavailable": true } }
+	}`
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "20181101000000_update_users.json"), []byte(operation), os.ModePerm))
+
+	e := esdt.New(&esdt.Config{Conn: server.URL, TargetDir: dir})
+	assert.Nil(t, e.RunAll())
+
+	r := lastRequest(stub, "POST", "/users/_update_by_query")
+	assert.Equal(t, "conflicts=proceed&refresh=true&requests_per_second=1000000&wait_for_active_shards=2", r.URL.RawQuery)
+
+	loaded, err := e.Load("20181101000000_update_users")
+	assert.Nil(t, err)
+	e.Rollback(loaded)
+	r = lastRequest(stub, "POST", "/users/_refresh")
+	assert.Equal(t, "ignore_unavailable=true", r.URL.RawQuery)
+}
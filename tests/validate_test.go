@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"20181101000000_valid.json":       "{ \"method\": \"PUT\", \"uri\": \"valid\", \"body\": { \"settings\": {} }, \"rollback\": { \"method\": \"DELETE\", \"uri\": \"valid\" } }",
+		"20181102000000_broken.json":      "{ \"method\": \"PUT\", ",
+		"20181103000000_unknown.json":     "{ \"method\": \"PUT\", \"url\": \"unknown\", \"rollback\": { \"mode\": \"auto\" } }",
+		"20181104000000_method.json":      "{ \"method\": \"FETCH\", \"uri\": \"method\", \"rollback\": { \"mode\": \"auto\" } }",
+		"20181105000000_no_rollback.json": "{ \"method\": \"POST\", \"uri\": \"test/_doc\" }",
+		"untimestamped.json":              "{ \"method\": \"GET\", \"uri\": \"_cluster/health\", \"rollback\": { \"mode\": \"auto\" } }",
+		"20181106000000_duplicate.json":   "{ \"method\": \"GET\", \"uri\": \"_cluster/health\", \"rollback\": { \"mode\": \"auto\" } }",
+		"20181106000000_duplicate.yml":    "method: GET\nuri: _cluster/health\nrollback:\n  mode: auto\n",
+		"20181107000000_pipeline.json":    "{ \"method\": \"PUT\", \"uri\": \"_ingest/pipeline/p\", \"body\": { \"processor\": [] }, \"rollback\": { \"mode\": \"auto\" } }",
+	}
+	for k, v := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, k), []byte(v), os.ModePerm))
+	}
+
+	e := esdt.New(&esdt.Config{TargetDir: dir})
+	issues, err := e.Validate()
+	assert.Nil(t, err)
+
+	found := make(map[string][]string)
+	for _, v := range issues {
+		found[v.File] = append(found[v.File], v.Message)
+	}
+	contains := func(file string, message string) {
+		for _, v := range found[file] {
+			if strings.Contains(v, message) {
+				return
+			}
+		}
+		t.Errorf("Expected %s to report %q, got %v", file, message, found[file])
+	}
+
+	assert.Empty(t, found["20181101000000_valid.json"])
+	contains("20181102000000_broken.json", "Could not parse json")
+	contains("20181103000000_unknown.json", "Unknown field \"url\"")
+	contains("20181104000000_method.json", "Invalid method \"FETCH\"")
+	contains("20181105000000_no_rollback.json", "No rollback listed")
+	contains("untimestamped.json", "does not start with a timestamp")
+	contains("20181106000000_duplicate.json", "Duplicate operation id 20181106000000_duplicate")
+	contains("20181107000000_pipeline.json", "missing processors")
+	contains("20181107000000_pipeline.json", "processor is not expected")
+
+	for _, v := range issues {
+		if v.File == "20181105000000_no_rollback.json" || v.File == "untimestamped.json" {
+			assert.True(t, v.Warning)
+		}
+	}
+
+	_, err = esdt.New(&esdt.Config{TargetDir: filepath.Join(dir, "missing")}).Validate()
+	assert.Error(t, err)
+}
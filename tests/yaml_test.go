@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"esdt/esdt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const yamlOperation = `# Stores the scoring script
+method: PUT
+uri: _scripts/score
+params:
+  timeout: 30s
+  refresh: true
+  wait_for_active_shards: 2
+body:
+  script:
+    lang: painless
+    source: |
+      double score = doc['rank'].value;
+      return score * 2;
+rollback:
+  method: DELETE
+  uri: _scripts/score
+`
+
+func TestYamlOperation(t *testing.T) {
+	stub := &stubEs{}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "esdt")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "20181101000000_script.yml"), []byte(yamlOperation), os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "20181102000000_index.json"), []byte("{ \"method\": \"PUT\", \"uri\": \"yaml_index\" }"), os.ModePerm))
+	configFile := filepath.Join(dir, "config.yml")
+	assert.Nil(t, ioutil.WriteFile(configFile, []byte("dev:\n  conn: "+server.URL+"\n"), os.ModePerm))
+
+	e := esdt.New(&esdt.Config{
+		TargetDir:  dir,
+		ConfigFile: configFile,
+		Env:        "dev",
+	})
+
+	operation, err := e.Load("20181101000000_script")
+	assert.Nil(t, err)
+	assert.Equal(t, "20181101000000_script", operation.Id)
+	assert.Equal(t, "30s", operation.Params["timeout"])
+	assert.Equal(t, true, operation.Params["refresh"])
+	assert.Equal(t, "DELETE", operation.Rollback.Method)
+	script := operation.Body["script"].(map[string]interface{})
+	assert.Equal(t, "double score = doc['rank'].value;\nreturn score * 2;\n", script["source"])
+
+	assert.Nil(t, e.RunAll())
+
+	var paths []string
+	for _, r := range stub.Requests() {
+		if r.Method == "PUT" {
+			paths = append(paths, r.URL.Path)
+		}
+	}
+	assert.Equal(t, []string{"/_scripts/score", "/yaml_index"}, paths)
+
+	r := lastRequest(stub, "PUT", "/_scripts/score")
+	assert.Equal(t, "refresh=true&timeout=30s&wait_for_active_shards=2", r.URL.RawQuery)
+}